@@ -0,0 +1,80 @@
+// Non-interactive use, printing the result instead of displaying it.
+
+package vxsv
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type BatchOptions struct {
+	Filter  string   // Same syntax as FILTER MODE
+	Sort    string   // Column name
+	Reverse bool     // Sort descending
+	Columns []string // Defaults to all of them
+	Format  ExportFormat
+	Table   string // For SQL output
+}
+
+func findColumn(columns []Column, name string) (int, error) {
+	for i, col := range columns {
+		if col.Name == name {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("No such column: \"%s\"", name)
+}
+
+// Load all of source, then filter, sort and write it out the same way the
+// interactive UI would.
+func RunBatch(source RowSource, w io.Writer, opts BatchOptions) error {
+	ui := NewUI(source)
+	ui.batch = true
+
+	for !source.Done() {
+		time.Sleep(LoadRefreshInterval)
+	}
+
+	if err := source.Err(); err != nil {
+		return err
+	}
+
+	ui.syncSource()
+
+	if strings.TrimSpace(opts.Filter) != "" {
+		filter, err := ui.parseFilter(opts.Filter)
+		if err != nil {
+			return err
+		}
+
+		ui.filterRows(filter)
+	}
+
+	if opts.Sort != "" {
+		colIdx, err := findColumn(ui.columns, opts.Sort)
+		if err != nil {
+			return err
+		}
+
+		ui.sortRows(colIdx, opts.Reverse)
+	}
+
+	columns := ui.exportColumns()
+	if len(opts.Columns) > 0 {
+		columns = make([]int, len(opts.Columns))
+
+		for i, name := range opts.Columns {
+			colIdx, err := findColumn(ui.columns, name)
+			if err != nil {
+				return err
+			}
+
+			columns[i] = colIdx
+		}
+	}
+
+	return ui.writeView(NewExporter(w, opts.Format, opts.Table), columns, &Task{})
+}
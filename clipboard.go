@@ -0,0 +1,46 @@
+// Copying values out of vxsv.
+
+package vxsv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Clipboard commands to try, in order
+var ClipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+}
+
+// Copy using the first available clipboard command, falling back to the
+// OSC 52 terminal escape sequence (supported by most modern terminals
+// and tmux) when there are none, e.g. over ssh.
+func copyToClipboard(value string) error {
+	for _, command := range ClipboardCommands {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = strings.NewReader(value)
+
+		return cmd.Run()
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(value))
+	_, err = fmt.Fprintf(tty, "\x1b]52;c;%s\x07", encoded)
+
+	return err
+}
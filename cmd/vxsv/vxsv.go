@@ -5,7 +5,9 @@ import (
 	"io"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/docopt/docopt-go"
 	"github.com/erik/vxsv"
@@ -15,8 +17,12 @@ func main() {
 	usage := fmt.Sprintf(`view [x] separated values
 
 Usage:
-  vxsv [--psql | --mysql | --delimiter=DELIM | --tabs]
-       [--no-headers] [--count=N] [PATH | -]
+  vxsv [--psql | --mysql | --json | --fixed | --widths=LIST |
+        --delimiter=DELIM | --tabs]
+       [--headers | --no-headers] [--lenient] [--encoding=NAME]
+       [--count=N] [--null=STRING] [--query=SQL]
+       [--filter=EXPR] [--sort=COLUMN [--reverse]] [--columns=LIST]
+       [--output-format=FMT] [PATH | -]
   vxsv -h | --help
 
 Arguments:
@@ -26,22 +32,44 @@ Options:
   -h --help                 show this help message and exit.
   -p --psql                 parse output of psql cli (used as a pager)
   -m --mysql                parse output of mysql cli
+  -j --json                 parse JSON Lines or a JSON array of objects
+  -x --fixed                parse columns lined up with spaces (docker ps, kubectl)
+  -w --widths=LIST          comma separated widths of fixed width columns.
   -n --count=N              only read N records.
+  --headers                 read headers from first row (guessed by default)
   -H --no-headers           don't read headers from first row (for separated values)
-  -d --delimiter=DELIM      separator for values [default: ,].
+  -d --delimiter=DELIM      separator for values (guessed by default).
   -t --tabs                 use tabs as separator value.
+  -l --lenient              pad short rows and keep going past malformed ones.
+  -e --encoding=NAME        input encoding, e.g. utf-16, latin1 or cp1252.
+  --null=STRING             how NULL is printed by psql (\pset null) or mysql.
+  -q --query=SQL            query to run on an SQLite database.
+
+Batch options:
+  -f --filter=EXPR          only print rows matching a filter expression.
+  -s --sort=COLUMN          sort rows by the given column.
+  -r --reverse              sort in descending order.
+  -c --columns=LIST         comma separated list of columns to print.
+  -o --output-format=FMT    one of csv, tsv, jsonl, markdown or sql.
+
+Given any of the batch options, or when stdout isn't a terminal, rows are
+printed to stdout instead of being displayed.
 `)
 
 	args, _ := docopt.Parse(usage, nil, true, "0.0.0", false)
 
 	var count int64 = math.MaxInt64
-	var data *vxsv.TabularData
+	var data vxsv.RowSource
 	var err error
 
 	// default to stdin if we don't have an explicit file passed in
 	reader := io.Reader(os.Stdin)
+	tableName := "stdin"
+	fileName, _ := args["PATH"].(string)
+
+	if fileName != "" && fileName != "-" {
+		tableName = strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
 
-	if fileName, ok := args["PATH"].(string); ok && fileName != "-" {
 		file, err := os.Open(fileName)
 		if err != nil {
 			fmt.Printf("Failed to open \"%s\": %v", fileName, err)
@@ -51,6 +79,19 @@ Options:
 		reader = io.Reader(file)
 	}
 
+	// Compressed input is recognized by its first few bytes
+	if reader, err = vxsv.Decompress(reader); err != nil {
+		fmt.Printf("Failed to decompress input: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Byte order marks are taken care of even without --encoding
+	encoding, _ := args["--encoding"].(string)
+	if reader, err = vxsv.Decode(reader, encoding); err != nil {
+		fmt.Printf("Failed to decode input: %v\n", err)
+		os.Exit(1)
+	}
+
 	if countStr, ok := args["--count"].(string); ok {
 		if count, err = strconv.ParseInt(countStr, 10, 64); err != nil {
 			fmt.Printf("Invalid value given for count: %s\n", countStr)
@@ -58,33 +99,180 @@ Options:
 		}
 	}
 
-	if args["--psql"] == true {
-		if data, err = vxsv.ReadPSQLTable(reader, count); err != nil {
-			fmt.Printf("Failed to read PSQL data: %v", err)
+	null, _ := args["--null"].(string)
+
+	// Flags win over whatever the input looks like
+	var sniffed vxsv.Sniffed
+	var widths []int
+
+	if widthList, ok := args["--widths"].(string); ok {
+		if widths, err = vxsv.ParseWidths(widthList); err != nil {
+			fmt.Printf("%v\n", err)
 			os.Exit(1)
 		}
+	}
+
+	if args["--psql"] == true {
+		sniffed.Format = vxsv.InputPSQL
 	} else if args["--mysql"] == true {
-		if data, err = vxsv.ReadMySQLTable(reader, count); err != nil {
-			fmt.Printf("Failed to read MySQL data: %v", err)
-			os.Exit(1)
-		}
+		sniffed.Format = vxsv.InputMySQL
+	} else if args["--json"] == true {
+		sniffed.Format = vxsv.InputJSON
+	} else if args["--fixed"] == true || widths != nil {
+		sniffed = vxsv.Sniffed{Format: vxsv.InputFixed, Header: true}
 	} else {
-		delimiter := ','
+		var delimiter rune
 		if args["--tabs"] == true {
 			delimiter = '\t'
 		} else if delimStr, ok := args["--delimiter"].(string); ok {
 			delimiter = []rune(delimStr)[0]
 		}
 
-		readHeaders := args["--no-headers"] == false
+		if reader, sniffed, err = vxsv.Sniff(reader, delimiter); err != nil {
+			fmt.Printf("Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-		if data, err = vxsv.ReadCSVFile(reader, delimiter, readHeaders, count); err != nil {
-			fmt.Printf("Failed to read CSV file (do you have the right delimiter?): %v\n", err)
+	if args["--headers"] == true {
+		sniffed.Header = true
+	} else if args["--no-headers"] == true {
+		sniffed.Header = false
+	}
+
+	query, _ := args["--query"].(string)
+	if query != "" && sniffed.Format != vxsv.InputSQLite {
+		fmt.Printf("--query only works on SQLite databases, input looks like %s\n", sniffed)
+		os.Exit(1)
+	}
+
+	var db *vxsv.Database
+	var tables []vxsv.DatabaseTable
+	format := sniffed.String()
+
+	switch sniffed.Format {
+	case vxsv.InputPSQL:
+		if data, err = vxsv.ReadPSQLTable(reader, null, count); err != nil {
+			fmt.Printf("Failed to read PSQL data: %v", err)
+			os.Exit(1)
+		}
+	case vxsv.InputMySQL:
+		if _, ok := args["--null"].(string); !ok {
+			null = "NULL"
+		}
+
+		if data, err = vxsv.ReadMySQLTable(reader, null, count); err != nil {
+			fmt.Printf("Failed to read MySQL data: %v", err)
 			os.Exit(1)
 		}
+	case vxsv.InputJSON:
+		if data, err = vxsv.ReadJSONFile(reader, count); err != nil {
+			fmt.Printf("Failed to read JSON data: %v", err)
+			os.Exit(1)
+		}
+	case vxsv.InputSpreadsheet:
+		if data, err = vxsv.ReadSpreadsheet(reader, sniffed.Header, count); err != nil {
+			fmt.Printf("Failed to read spreadsheet: %v\n", err)
+			os.Exit(1)
+		}
+	case vxsv.InputSQLite:
+		// SQLite needs the file itself, not a stream of it
+		if file, ok := reader.(*os.File); !ok || file == os.Stdin {
+			fmt.Printf("SQLite databases can only be read from an uncompressed file\n")
+			os.Exit(1)
+		}
+
+		if db, err = vxsv.OpenSQLite(fileName, count); err != nil {
+			fmt.Printf("Failed to open database: %v\n", err)
+			os.Exit(1)
+		}
+
+		if query != "" {
+			data, err = db.Query(query)
+			format = "sqlite query"
+		} else if tables, err = db.Tables(); err == nil {
+			if len(tables) == 0 {
+				fmt.Printf("No tables found in database\n")
+				os.Exit(1)
+			}
+
+			// Start out with the first one, the others are picked from a list
+			data, err = db.Table(tables[0].Name)
+			format = tables[0].String()
+			tableName = tables[0].Name
+		}
+
+		if err != nil {
+			fmt.Printf("Failed to read database: %v\n", err)
+			os.Exit(1)
+		}
+	case vxsv.InputFixed:
+		if data, err = vxsv.ReadFixedWidth(reader, widths, sniffed.Header, count); err != nil {
+			fmt.Printf("Failed to read fixed width data: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		lenient := args["--lenient"] == true
+
+		if data, err = vxsv.ReadCSVFile(reader, sniffed.Delimiter, sniffed.Header, lenient, count); err != nil {
+			fmt.Printf("Failed to read input as %s (try --delimiter or --psql): %v\n", sniffed, err)
+			os.Exit(1)
+		}
+	}
+
+	if isBatch(args) {
+		if len(tables) > 1 {
+			fmt.Fprintf(os.Stderr, "Database has several tables, pick one with --query: %s\n", tableNames(tables))
+			os.Exit(1)
+		}
+
+		opts := vxsv.BatchOptions{
+			Reverse: args["--reverse"] == true,
+			Table:   tableName,
+		}
+
+		if filter, ok := args["--filter"].(string); ok {
+			opts.Filter = filter
+		}
+
+		if sort, ok := args["--sort"].(string); ok {
+			opts.Sort = sort
+		}
+
+		if columns, ok := args["--columns"].(string); ok {
+			opts.Columns = strings.Split(columns, ",")
+		}
+
+		if format, ok := args["--output-format"].(string); ok {
+			if opts.Format, err = vxsv.ParseExportFormat(format); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if err := vxsv.RunBatch(data, os.Stdout, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to process rows: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, problem := range vxsv.SourceProblems(data) {
+			fmt.Fprintf(os.Stderr, "line %d: %s\n", problem.Line, problem.Message)
+		}
+
+		return
 	}
 
 	ui := vxsv.NewUI(data)
+	ui.SetFormat(format)
+
+	if db != nil {
+		ui.SetDatabase(db)
+
+		if len(tables) > 1 {
+			ui.ShowTablePicker()
+		}
+	}
+
 	if err := ui.Init(); err != nil {
 		fmt.Printf("Failed to initialize terminal UI: %v\n", err)
 		os.Exit(1)
@@ -92,3 +280,25 @@ Options:
 
 	ui.Loop()
 }
+
+// Print instead of displaying when asked to, or when there's nowhere to
+// display to.
+func isBatch(args map[string]interface{}) bool {
+	for _, opt := range []string{"--filter", "--sort", "--columns", "--output-format"} {
+		if _, ok := args[opt].(string); ok {
+			return true
+		}
+	}
+
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+func tableNames(tables []vxsv.DatabaseTable) string {
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		names[i] = table.Name
+	}
+
+	return strings.Join(names, ", ")
+}
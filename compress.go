@@ -0,0 +1,71 @@
+// Reading compressed input.
+
+package vxsv
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type decompressor struct {
+	magic []byte
+	open  func(io.Reader) (io.Reader, error)
+}
+
+// Recognized by the first few bytes of the input, whatever the file is
+// called.
+var decompressors = []decompressor{
+	{[]byte{0x1f, 0x8b, 0x08}, func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	}},
+	{[]byte("BZh"), func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	}},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r)
+	}},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, func(r io.Reader) (io.Reader, error) {
+		return zstd.NewReader(r)
+	}},
+}
+
+// Longest magic number we look for
+const magicLength = 6
+
+func findDecompressor(header []byte) *decompressor {
+	for i, d := range decompressors {
+		if !bytes.HasPrefix(header, d.magic) {
+			continue
+		}
+
+		// "BZh" is followed by the block size, don't mistake text for it
+		if d.magic[0] == 'B' && (len(header) < 4 || header[3] < '1' || header[3] > '9') {
+			continue
+		}
+
+		return &decompressors[i]
+	}
+
+	return nil
+}
+
+// Decompress wraps the input in a reader for gzip, bzip2, xz or zstd data
+// if it starts like one. Regular files that aren't compressed are handed
+// back as they are, so that they can still be indexed (see StreamSource).
+func Decompress(input io.Reader) (io.Reader, error) {
+	reader, header, err := peekInput(input, magicLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if d := findDecompressor(header); d != nil {
+		return d.open(reader)
+	}
+
+	return reader, nil
+}
@@ -0,0 +1,105 @@
+package vxsv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const compressText = "a,b\n1,2\n"
+
+// compressText as written by bzip2 -9, which has no writer in the standard
+// library
+var bzip2Text = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xbf, 0x87,
+	0x40, 0x7f, 0x00, 0x00, 0x03, 0x59, 0x00, 0x00, 0x10, 0x00, 0x04, 0x30,
+	0x00, 0x30, 0x00, 0x20, 0x00, 0x30, 0xc0, 0x08, 0x69, 0xb2, 0x88, 0x23,
+	0x27, 0x8b, 0xb9, 0x22, 0x9c, 0x28, 0x48, 0x5f, 0xc3, 0xa0, 0x3f, 0x80,
+}
+
+func compressWith(t *testing.T, open func(io.Writer) (io.WriteCloser, error)) []byte {
+	var buf bytes.Buffer
+
+	w, err := open(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte(compressText)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	inputs := map[string][]byte{
+		"plain": []byte(compressText),
+		"gzip": compressWith(t, func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		}),
+		"bzip2": bzip2Text,
+		"xz": compressWith(t, func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		}),
+		"zstd": compressWith(t, func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		}),
+	}
+
+	for name, input := range inputs {
+		reader, err := Decompress(bytes.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if text, err := io.ReadAll(reader); err != nil || string(text) != compressText {
+			t.Errorf("%s: read %q, %v, want %q", name, text, err, compressText)
+		}
+	}
+}
+
+// Text that happens to start like bzip2 isn't mistaken for it
+func TestDecompressText(t *testing.T) {
+	for _, text := range []string{"BZh", "BZhx,y\n", "BZ"} {
+		reader, err := Decompress(strings.NewReader(text))
+		if err != nil {
+			t.Errorf("Decompress(%q): %v", text, err)
+			continue
+		}
+
+		if got, _ := io.ReadAll(reader); string(got) != text {
+			t.Errorf("Decompress(%q) read %q", text, got)
+		}
+	}
+}
+
+// Uncompressed files are handed back as they are, to be indexed
+func TestDecompressFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, []byte(compressText), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if reader, err := Decompress(file); err != nil || reader != io.Reader(file) {
+		t.Errorf("Decompress(file) = %v, %v, want the file itself", reader, err)
+	}
+}
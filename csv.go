@@ -1,69 +1,186 @@
 package vxsv
 
 import (
+	"bytes"
 	"encoding/csv"
-	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 )
 
-func ReadCSVFile(reader io.Reader, delimiter rune, readHeader bool, count int64) (*TabularData, error) {
-	csv := csv.NewReader(reader)
+// In lenient mode, any fields past the end of the header end up in an
+// extra column with this name.
+const OverflowColumn = "[overflow]"
+
+// A record that didn't match the header, see ReadCSVFile
+type ReadProblem struct {
+	Line    int // Of the input, starting at 1
+	Row     int // The row it was read as
+	Message string
+}
+
+type csvRecords struct {
+	csv       *csv.Reader
+	columns   int
+	delimiter rune
+	lenient   bool
+	source    *StreamSource
+	rows      int  // Records read so far
+	overflow  bool // Whether OverflowColumn has been added
 
-	data := &TabularData{
-		Rows: make([][]string, 0, 100),
+	mu       sync.Mutex
+	problems []ReadProblem
+}
+
+func (r *csvRecords) Read() ([]string, int64, error) {
+	record, err := r.csv.Read()
+	if err != nil {
+		return nil, 0, err
 	}
 
+	line, _ := r.csv.FieldPos(0)
+	row := r.rows
+	r.rows++
+
+	if len(record) != r.columns {
+		if !r.lenient {
+			return nil, 0, fmt.Errorf("Row on line %d has %d columns instead of %d", line, len(record), r.columns)
+		}
+
+		message := fmt.Sprintf("%d of %d columns, padded with empty cells", len(record), r.columns)
+
+		if len(record) > r.columns {
+			message = fmt.Sprintf("%d of %d columns, the rest are in %s", len(record), r.columns, OverflowColumn)
+
+			if !r.overflow {
+				r.source.addColumn(OverflowColumn)
+				r.overflow = true
+			}
+		}
+
+		r.mu.Lock()
+		r.problems = append(r.problems, ReadProblem{line, row, message})
+		r.mu.Unlock()
+	}
+
+	return escapeNuls(fitRecord(record, r.columns, r.delimiter)), r.csv.InputOffset(), nil
+}
+
+// Join any fields past the last column back together. Short records are
+// padded out by StreamSource.Row.
+func fitRecord(record []string, columns int, delimiter rune) []string {
+	if len(record) <= columns {
+		return record
+	}
+
+	overflow := strings.Join(record[columns:], string(delimiter))
+	return append(record[:columns:columns], overflow)
+}
+
+// Sources that skipped over problems in the input
+type problemReporter interface {
+	Problems() []ReadProblem
+}
+
+type csvSource struct {
+	*StreamSource
+	records *csvRecords
+}
+
+func (s csvSource) Problems() []ReadProblem {
+	s.records.mu.Lock()
+	defer s.records.mu.Unlock()
+
+	// Only ever appended to, so the part seen so far won't change
+	return s.records.problems[:len(s.records.problems):len(s.records.problems)]
+}
+
+// Problems found while reading source, if it keeps track of any.
+func SourceProblems(source RowSource) []ReadProblem {
+	if source, ok := source.(problemReporter); ok {
+		return source.Problems()
+	}
+
+	return nil
+}
+
+// Reads the header (or first row) immediately and the remaining records
+// in the background.
+//
+// Normally every record has to have as many fields as the header. When
+// lenient, short records are padded, long ones have the extra fields
+// moved into OverflowColumn, stray quotes are taken literally, and each
+// record that didn't fit is reported as a ReadProblem.
+func ReadCSVFile(reader io.Reader, delimiter rune, readHeader, lenient bool, count int64) (RowSource, error) {
+	var columns []Column
+
+	source := newStreamSource(reader, func(buf []byte) ([]string, error) {
+		csv := csv.NewReader(bytes.NewReader(buf))
+		csv.Comma = delimiter
+		csv.FieldsPerRecord = -1
+		csv.LazyQuotes = lenient
+
+		record, err := csv.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		return fitRecord(record, len(columns), delimiter), nil
+	})
+
+	// Field counts are checked by csvRecords
+	csv := csv.NewReader(reader)
 	csv.Comma = delimiter
+	csv.FieldsPerRecord = -1
+	csv.LazyQuotes = lenient
+
+	records := &csvRecords{
+		csv:       csv,
+		delimiter: delimiter,
+		lenient:   lenient,
+		source:    source,
+	}
 
 	if readHeader {
 		if headers, err := csv.Read(); err == nil {
-			columns := make([]Column, len(headers))
+			headers = escapeNuls(headers)
+			columns = make([]Column, len(headers))
 			for i, col := range headers {
-				width := clamp(len(col), 1, len(col))
+				width := displayWidth(col)
+				width = clamp(width, 1, width)
 				columns[i] = Column{Name: col, Width: width}
 			}
-
-			data.Columns = columns
 		} else {
 			return nil, err
 		}
-	}
 
-	var i int64
-	for i = 0; i < count; i++ {
+		source.begin(columns, csv.InputOffset())
+	} else {
+		// Use first row to set number of columns
 		record, err := csv.Read()
-
-		if err == io.EOF {
-			break
-		} else if err != nil {
+		if err != nil && err != io.EOF {
 			return nil, err
 		}
 
-		// Use first row to set number of columns
-		if !readHeader && i == 0 {
-			data.Columns = make([]Column, len(record))
-			for j := range record {
-				name := fmt.Sprintf("[%d]", j)
-				data.Columns[j] = Column{
-					Name:  name,
-					Width: len(name),
-				}
+		columns = make([]Column, len(record))
+		for j := range record {
+			name := fmt.Sprintf("[%d]", j)
+			columns[j] = Column{
+				Name:  name,
+				Width: len(name),
 			}
 		}
 
-		if len(record) != len(data.Columns) {
-			return nil, errors.New("Row has incorrect number of columns")
-		}
-
-		data.Rows = append(data.Rows, record)
-
-		for j, col := range record {
-			if len(col) > data.Columns[j].Width {
-				data.Columns[j].Width = len(col)
-			}
+		source.begin(columns, 0)
+		if err == nil && count > 0 {
+			source.add(escapeNuls(record), csv.InputOffset())
+			records.rows++
 		}
 	}
 
-	return data, nil
+	records.columns = len(columns)
+	go source.load(records, count)
+
+	return csvSource{source, records}, nil
 }
@@ -0,0 +1,144 @@
+package vxsv
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Wait for a source to finish loading, returning its column names and rows
+func readSource(t *testing.T, source RowSource) ([]string, [][]string) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); !source.Done(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("source never finished loading")
+		}
+	}
+
+	if err := source.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, col := range source.Header() {
+		names = append(names, col.Name)
+	}
+
+	rows := [][]string{}
+	for i := 0; i < source.Len(); i++ {
+		rows = append(rows, source.Row(i))
+	}
+
+	return names, rows
+}
+
+// The same text read from a pipe and from a file, which is indexed and
+// read back from byte offsets
+func pipeAndFile(t *testing.T, text string) map[string]func() io.Reader {
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]func() io.Reader{
+		"pipe": func() io.Reader { return strings.NewReader(text) },
+		"file": func() io.Reader {
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { file.Close() })
+			return file
+		},
+	}
+}
+
+func TestReadCSVFileNul(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		header bool
+		names  []string
+		rows   [][]string
+	}{
+		{
+			"header",
+			"a\x00,b\n\x00,x\x00y\n",
+			true,
+			[]string{"a␀", "b"},
+			[][]string{{"␀", "x␀y"}},
+		},
+		{
+			"no header",
+			"\x00,b\nc,\x00\n",
+			false,
+			[]string{"[0]", "[1]"},
+			[][]string{{"␀", "b"}, {"c", "␀"}},
+		},
+	}
+
+	for _, test := range tests {
+		for kind, input := range pipeAndFile(t, test.text) {
+			source, err := ReadCSVFile(input(), ',', test.header, false, 100)
+			if err != nil {
+				t.Errorf("%s from a %s: %v", test.name, kind, err)
+				continue
+			}
+
+			names, rows := readSource(t, source)
+			if !reflect.DeepEqual(names, test.names) || !reflect.DeepEqual(rows, test.rows) {
+				t.Errorf("%s from a %s: read %q %q, want %q %q", test.name, kind, names, rows, test.names, test.rows)
+			}
+		}
+	}
+}
+
+func TestReadCSVFileLenient(t *testing.T) {
+	text := "a,b\n1,2\n3\n4,5,6,7\nx\"y,8\n"
+
+	wantNames := []string{"a", "b", OverflowColumn}
+	wantRows := [][]string{{"1", "2", ""}, {"3", "", ""}, {"4", "5", "6,7"}, {"x\"y", "8", ""}}
+	wantProblems := []ReadProblem{
+		{3, 1, "1 of 2 columns, padded with empty cells"},
+		{4, 2, "4 of 2 columns, the rest are in " + OverflowColumn},
+	}
+
+	for kind, input := range pipeAndFile(t, text) {
+		source, err := ReadCSVFile(input(), ',', true, true, 100)
+		if err != nil {
+			t.Errorf("from a %s: %v", kind, err)
+			continue
+		}
+
+		names, rows := readSource(t, source)
+		if !reflect.DeepEqual(names, wantNames) || !reflect.DeepEqual(rows, wantRows) {
+			t.Errorf("from a %s: read %q %q, want %q %q", kind, names, rows, wantNames, wantRows)
+		}
+
+		if problems := SourceProblems(source); !reflect.DeepEqual(problems, wantProblems) {
+			t.Errorf("from a %s: problems %v, want %v", kind, problems, wantProblems)
+		}
+	}
+}
+
+// Without lenient, loading stops at the first row that doesn't fit
+func TestReadCSVFileStrict(t *testing.T) {
+	source, err := ReadCSVFile(strings.NewReader("a,b\n1,2\n3\n4,5\n"), ',', true, false, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for !source.Done() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if source.Err() == nil || source.Len() != 1 {
+		t.Errorf("read %d rows with error %v, want 1 row and an error", source.Len(), source.Err())
+	}
+}
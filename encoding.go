@@ -0,0 +1,86 @@
+// Converting input in other text encodings to UTF-8.
+
+package vxsv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// Look up an encoding by any of its usual names, e.g. "latin1", "cp1252"
+// or "UTF-16LE".
+func findEncoding(name string) (encoding.Encoding, error) {
+	if enc, err := htmlindex.Get(name); err == nil {
+		return enc, nil
+	}
+
+	if enc, err := ianaindex.IANA.Encoding(name); err == nil && enc != nil {
+		return enc, nil
+	}
+
+	return nil, fmt.Errorf("Unknown encoding: \"%s\"", name)
+}
+
+// Decode converts the input to UTF-8 from the named encoding. A byte
+// order mark at the start of the input is dropped, and takes precedence
+// over the name, which defaults to UTF-8.
+//
+// UTF-8 input is handed back as it is where possible, so that regular
+// files can still be indexed (see StreamSource).
+func Decode(input io.Reader, name string) (io.Reader, error) {
+	var enc encoding.Encoding = unicode.UTF8
+
+	if name != "" {
+		var err error
+		if enc, err = findEncoding(name); err != nil {
+			return nil, err
+		}
+	}
+
+	reader, header, err := peekInput(input, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	// UTF-8 only needs the byte order mark skipped
+	if bytes.HasPrefix(header, utf8BOM) || (enc == unicode.UTF8 && !hasUTF16BOM(header)) {
+		return skipBOM(reader, header)
+	}
+
+	// Switches to UTF-16 on seeing its byte order mark
+	decoder := unicode.BOMOverride(enc.NewDecoder())
+
+	return transform.NewReader(reader, decoder), nil
+}
+
+func hasUTF16BOM(header []byte) bool {
+	return bytes.HasPrefix(header, []byte{0xff, 0xfe}) || bytes.HasPrefix(header, []byte{0xfe, 0xff})
+}
+
+// Move past a UTF-8 byte order mark, if there is one
+func skipBOM(reader io.Reader, header []byte) (io.Reader, error) {
+	if !bytes.HasPrefix(header, utf8BOM) {
+		return reader, nil
+	}
+
+	switch r := reader.(type) {
+	case *os.File:
+		_, err := r.Seek(int64(len(utf8BOM)), io.SeekCurrent)
+		return r, err
+	case *peekReader:
+		r.discard(len(utf8BOM))
+		return r, nil
+	}
+
+	return reader, nil
+}
@@ -0,0 +1,45 @@
+package vxsv
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		encoding string
+		want     string
+	}{
+		{"utf-8", "a,é\n", "", "a,é\n"},
+		{"utf-8 bom", "\xef\xbb\xbfa,é\n", "", "a,é\n"},
+		{"utf-16le bom", "\xff\xfea\x00,\x00\xe9\x00\n\x00", "", "a,é\n"},
+		{"utf-16be bom", "\xfe\xff\x00a\x00,\x00\xe9\x00\n", "", "a,é\n"},
+		{"latin-1", "a,\xe9\n", "latin1", "a,é\n"},
+		{"windows-1252", "\x80,\x93x\x94\n", "cp1252", "€,“x”\n"},
+		{"bom over the name", "\xff\xfea\x00", "latin1", "a"},
+		{"explicit utf-16", "a\x00\n\x00", "utf-16le", "a\n"},
+	}
+
+	for _, test := range tests {
+		for kind, input := range pipeAndFile(t, test.input) {
+			reader, err := Decode(input(), test.encoding)
+			if err != nil {
+				t.Errorf("%s from a %s: %v", test.name, kind, err)
+				continue
+			}
+
+			if text, err := io.ReadAll(reader); err != nil || string(text) != test.want {
+				t.Errorf("%s from a %s: read %q, %v, want %q", test.name, kind, text, err, test.want)
+			}
+		}
+	}
+}
+
+func TestDecodeUnknown(t *testing.T) {
+	if _, err := Decode(strings.NewReader("a"), "klingon"); err == nil {
+		t.Error("Decode with an unknown encoding succeeded")
+	}
+}
@@ -0,0 +1,330 @@
+// Writing the current view back out in various formats.
+
+package vxsv
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type ExportFormat int
+
+const (
+	ExportCSV = iota
+	ExportTSV
+	ExportJSONLines
+	ExportMarkdown
+	ExportSQL
+)
+
+var exportFormatNames = map[string]ExportFormat{
+	"csv":      ExportCSV,
+	"tsv":      ExportTSV,
+	"jsonl":    ExportJSONLines,
+	"ndjson":   ExportJSONLines,
+	"md":       ExportMarkdown,
+	"markdown": ExportMarkdown,
+	"sql":      ExportSQL,
+}
+
+func ParseExportFormat(name string) (ExportFormat, error) {
+	if format, ok := exportFormatNames[strings.ToLower(name)]; ok {
+		return format, nil
+	}
+
+	return ExportCSV, fmt.Errorf("Unknown output format: \"%s\"", name)
+}
+
+// Guess the format from a file extension, defaulting to CSV
+func ExportFormatForPath(path string) ExportFormat {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+
+	if format, err := ParseExportFormat(ext); err == nil {
+		return format
+	}
+
+	return ExportCSV
+}
+
+// Exporter writes a header followed by rows, Close must be called to
+// flush everything out.
+type Exporter interface {
+	WriteHeader(columns []string) error
+	WriteRow(row []string) error
+	Close() error
+}
+
+// table is the name used for SQL INSERT statements
+func NewExporter(w io.Writer, format ExportFormat, table string) Exporter {
+	switch format {
+	case ExportTSV:
+		return newCSVExporter(w, '\t')
+	case ExportJSONLines:
+		return &jsonLinesExporter{out: bufio.NewWriter(w)}
+	case ExportMarkdown:
+		return &markdownExporter{out: bufio.NewWriter(w)}
+	case ExportSQL:
+		return &sqlExporter{out: bufio.NewWriter(w), table: table}
+	}
+
+	return newCSVExporter(w, ',')
+}
+
+type csvExporter struct {
+	out *csv.Writer
+}
+
+func newCSVExporter(w io.Writer, delimiter rune) *csvExporter {
+	out := csv.NewWriter(w)
+	out.Comma = delimiter
+
+	return &csvExporter{out}
+}
+
+func (e *csvExporter) WriteHeader(columns []string) error { return e.out.Write(columns) }
+func (e *csvExporter) WriteRow(row []string) error        { return e.out.Write(textValues(row)) }
+func (e *csvExporter) Close() error {
+	e.out.Flush()
+	return e.out.Error()
+}
+
+type jsonLinesExporter struct {
+	out     *bufio.Writer
+	columns []string
+}
+
+func (e *jsonLinesExporter) WriteHeader(columns []string) error {
+	e.columns = columns
+	return nil
+}
+
+// Written by hand to keep keys in column order
+func (e *jsonLinesExporter) WriteRow(row []string) error {
+	e.out.WriteByte('{')
+
+	for i, name := range e.columns {
+		if i > 0 {
+			e.out.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(name)
+		value, err := json.Marshal(jsonString(row[i]))
+		if err != nil {
+			return err
+		}
+
+		e.out.Write(key)
+		e.out.WriteByte(':')
+		e.out.Write(value)
+	}
+
+	_, err := e.out.WriteString("}\n")
+	return err
+}
+
+func (e *jsonLinesExporter) Close() error { return e.out.Flush() }
+
+type markdownExporter struct {
+	out *bufio.Writer
+}
+
+func (e *markdownExporter) writeLine(cells []string) error {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		cell = strings.Replace(cell, "|", "\\|", -1)
+		escaped[i] = strings.Replace(cell, "\n", "<br>", -1)
+	}
+
+	_, err := fmt.Fprintf(e.out, "| %s |\n", strings.Join(escaped, " | "))
+	return err
+}
+
+func (e *markdownExporter) WriteHeader(columns []string) error {
+	if err := e.writeLine(columns); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(e.out, "|%s\n", strings.Repeat(" --- |", len(columns)))
+	return err
+}
+
+func (e *markdownExporter) WriteRow(row []string) error { return e.writeLine(textValues(row)) }
+func (e *markdownExporter) Close() error                { return e.out.Flush() }
+
+type sqlExporter struct {
+	out     *bufio.Writer
+	table   string
+	columns string
+}
+
+func quoteSQLIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func quoteSQLString(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+func (e *sqlExporter) WriteHeader(columns []string) error {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteSQLIdentifier(col)
+	}
+
+	e.columns = strings.Join(quoted, ", ")
+	return nil
+}
+
+func (e *sqlExporter) WriteRow(row []string) error {
+	values := make([]string, len(row))
+	for i, value := range row {
+		if value == Null {
+			values[i] = "NULL"
+		} else {
+			values[i] = quoteSQLString(value)
+		}
+	}
+
+	_, err := fmt.Fprintf(e.out, "INSERT INTO %s (%s) VALUES (%s);\n",
+		quoteSQLIdentifier(e.table), e.columns, strings.Join(values, ", "))
+	return err
+}
+
+func (e *sqlExporter) Close() error { return e.out.Flush() }
+
+// NULL as null and everything else as a string. Guessing at numbers and
+// booleans would turn "007" into 7, "t" into true and lose precision on
+// long ids.
+func jsonString(str string) interface{} {
+	if str == Null {
+		return nil
+	}
+
+	return str
+}
+
+// Convert a cell into the most specific json type it looks like, for
+// showing a row rather than exporting it.
+func jsonValue(str string) interface{} {
+	if str == Null {
+		return nil
+	} else if v, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return v
+	} else if v, err := strconv.ParseFloat(str, 64); err == nil {
+		return v
+	} else if v, err := strconv.ParseBool(str); err == nil {
+		return v
+	}
+
+	return str
+}
+
+// Formats without NULL leave it empty
+func textValues(row []string) []string {
+	values := make([]string, len(row))
+
+	for i, value := range row {
+		if value != Null {
+			values[i] = value
+		}
+	}
+
+	return values
+}
+
+// Indices of the columns to export, in the order they're displayed
+// (pinned first). Collapsed columns are left out.
+func (ui *UI) exportColumns() []int {
+	columns := []int{}
+
+	for _, pinned := range []bool{true, false} {
+		for i, col := range ui.columns {
+			if col.Pinned == pinned && col.Display != ColumnCollapsed {
+				columns = append(columns, i)
+			}
+		}
+	}
+
+	return columns
+}
+
+// Write the displayed rows to a file in the background. Existing files
+// are only replaced when force is set.
+func (ui *UI) exportView(path string, format ExportFormat, force bool) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if os.IsExist(err) {
+		ui.pushErrorPopup("Not overwriting "+path, fmt.Errorf("use :w! to replace it"))
+		return
+	} else if err != nil {
+		ui.pushErrorPopup("Failed to open "+path, err)
+		return
+	}
+
+	table := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	columns := ui.exportColumns()
+
+	ui.runTask("Exporting", len(ui.filterMatches), func(t *Task) func() {
+		err := ui.writeView(NewExporter(file, format, table), columns, t)
+
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+
+		if t.Cancelled() {
+			os.Remove(path)
+			return nil
+		}
+
+		return func() {
+			if err != nil {
+				ui.pushErrorPopup("Failed to write "+path, err)
+			} else {
+				msg := fmt.Sprintf("Wrote %d rows to %s", len(ui.filterMatches), path)
+				ui.pushHandler(NewPopup(ui, msg))
+			}
+		}
+	})
+}
+
+func (ui *UI) writeView(exporter Exporter, columns []int, t *Task) error {
+	header := make([]string, len(columns))
+	for i, colIdx := range columns {
+		header[i] = ui.columns[colIdx].Name
+	}
+
+	if err := exporter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	values := make([]string, len(columns))
+	for _, idx := range ui.filterMatches {
+		if t.Cancelled() {
+			return nil
+		}
+
+		row := ui.getRow(idx)
+		for i, colIdx := range columns {
+			values[i] = row[colIdx]
+		}
+
+		if err := exporter.WriteRow(values); err != nil {
+			return err
+		}
+
+		t.Step()
+	}
+
+	return exporter.Close()
+}
@@ -0,0 +1,89 @@
+package vxsv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExporters(t *testing.T) {
+	columns := []string{"id", "name", "note"}
+	rows := [][]string{
+		{"007", "a|b", Null},
+		{"1.50", "it's\nhere", "true"},
+	}
+
+	tests := []struct {
+		format ExportFormat
+		want   string
+	}{
+		{ExportCSV, "id,name,note\n007,a|b,\n1.50,\"it's\nhere\",true\n"},
+		{ExportTSV, "id\tname\tnote\n007\ta|b\t\n1.50\t\"it's\nhere\"\ttrue\n"},
+		{ExportJSONLines, `{"id":"007","name":"a|b","note":null}` + "\n" +
+			`{"id":"1.50","name":"it's\nhere","note":"true"}` + "\n"},
+		{ExportMarkdown, "| id | name | note |\n| --- | --- | --- |\n| 007 | a\\|b |  |\n| 1.50 | it's<br>here | true |\n"},
+		{ExportSQL, `INSERT INTO "t" ("id", "name", "note") VALUES ('007', 'a|b', NULL);` + "\n" +
+			`INSERT INTO "t" ("id", "name", "note") VALUES ('1.50', 'it''s` + "\n" + `here', 'true');` + "\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		exporter := NewExporter(&out, test.format, "t")
+
+		if err := exporter.WriteHeader(columns); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, row := range rows {
+			if err := exporter.WriteRow(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := exporter.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if out.String() != test.want {
+			t.Errorf("format %d wrote %q, want %q", test.format, out.String(), test.want)
+		}
+	}
+}
+
+func TestJSONValue(t *testing.T) {
+	tests := []struct {
+		str  string
+		want interface{}
+	}{
+		{Null, nil},
+		{"42", int64(42)},
+		{"1.5", 1.5},
+		{"true", true},
+		{"abc", "abc"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := jsonValue(test.str); got != test.want {
+			t.Errorf("jsonValue(%q) = %#v, want %#v", test.str, got, test.want)
+		}
+	}
+}
+
+func TestExportFormatForPath(t *testing.T) {
+	tests := map[string]ExportFormat{
+		"out.csv":      ExportCSV,
+		"out.TSV":      ExportTSV,
+		"out.ndjson":   ExportJSONLines,
+		"out.jsonl":    ExportJSONLines,
+		"README.md":    ExportMarkdown,
+		"dump.sql":     ExportSQL,
+		"out.txt":      ExportCSV,
+		"no-extension": ExportCSV,
+	}
+
+	for path, want := range tests {
+		if got := ExportFormatForPath(path); got != want {
+			t.Errorf("ExportFormatForPath(%q) = %d, want %d", path, got, want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 type Filter interface {
@@ -19,17 +20,22 @@ func (f EmptyFilter) String() string        { return "" }
 func (f EmptyFilter) Matches([]string) bool { return true }
 
 type RowFilter struct {
+	expression    string
 	filter        string
 	caseSensitive bool
 }
 
-func (f RowFilter) String() string { return f.filter }
+func (f RowFilter) String() string { return f.expression }
 func (f RowFilter) Matches(row []string) bool {
 	if f.filter == "" {
 		return true
 	}
 
 	for _, col := range row {
+		if col == Null {
+			continue
+		}
+
 		if f.caseSensitive && strings.Contains(col, f.filter) {
 			return true
 		} else if !f.caseSensitive {
@@ -60,84 +66,562 @@ type ColumnFilter struct {
 	expression string
 	value      string
 	valueFloat float64
+	regex      *regexp.Regexp // Only for CmpMatch and CmpNoMatch
 	cmpType    ComparisonType
 	colIdx     int
 }
 
 const OpChars = "!=><~"
 
-var CmpOpRegex = regexp.MustCompile(`^(.+?)([!=><~]+)(.+)$`)
+// "column is null" or "column is not null"
+type NullFilter struct {
+	expression string
+	colIdx     int
+	isNull     bool
+}
 
-// parse a filter string into an instance of the Filter interface
-func (ui *UI) parseFilter(fs string) (Filter, error) {
-	if !strings.ContainsAny(fs, OpChars) {
-		return RowFilter{
-			filter:        fs,
-			caseSensitive: false,
-		}, nil
+func (f NullFilter) String() string { return f.expression }
+func (f NullFilter) Matches(row []string) bool {
+	return (row[f.colIdx] == Null) == f.isNull
+}
+
+// The end of a null check term, which has to be kept together even though
+// it may contain "not".
+var nullTestRegex = regexp.MustCompile(`(?i)^is\s+(not\s+)?null`)
+var nullTermRegex = regexp.MustCompile(`(?i)^(.*?)\s+is\s+(not\s+)?null$`)
+
+// Filters can be combined with these, e.g. "a == 1 and not (b > 2 or c)"
+type AndFilter struct {
+	expression string
+	filters    []Filter
+}
+
+type OrFilter struct {
+	expression string
+	filters    []Filter
+}
+
+type NotFilter struct {
+	expression string
+	filter     Filter
+}
+
+func (f AndFilter) String() string { return f.expression }
+func (f AndFilter) Matches(row []string) bool {
+	for _, filter := range f.filters {
+		if !filter.Matches(row) {
+			return false
+		}
 	}
+	return true
+}
 
-	if match := CmpOpRegex.FindStringSubmatch(fs); len(match) > 0 {
-		filter := ColumnFilter{
-			expression: fs,
+func (f OrFilter) String() string { return f.expression }
+func (f OrFilter) Matches(row []string) bool {
+	for _, filter := range f.filters {
+		if filter.Matches(row) {
+			return true
 		}
+	}
+	return false
+}
 
-		var (
-			column = strings.TrimSpace(match[1])
-			oper   = match[2]
-			value  = strings.TrimSpace(match[3])
-		)
+func (f NotFilter) String() string            { return f.expression }
+func (f NotFilter) Matches(row []string) bool { return !f.filter.Matches(row) }
 
-		filter.colIdx = -1
-		for i, col := range ui.columns {
-			if col.Name == column {
-				filter.colIdx = i
-				break
-			}
+// FilterError points to where in the expression parsing went wrong.
+type FilterError struct {
+	Expression string
+	Pos        int // In runes, so it lines up on screen
+	Msg        string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%s\n%s^\n%s (at position %d)",
+		e.Expression, strings.Repeat(" ", e.Pos), e.Msg, e.Pos+1)
+}
+
+type filterTokenKind int
+
+const (
+	TokTerm = iota
+	TokAnd
+	TokOr
+	TokNot
+	TokOpen
+	TokClose
+	TokEnd
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+var filterKeywords = map[string]filterTokenKind{
+	"and": TokAnd,
+	"&&":  TokAnd,
+	"or":  TokOr,
+	"||":  TokOr,
+	"not": TokNot,
+}
+
+func isFilterBoundary(runes []rune, i int) bool {
+	return i < 0 || i >= len(runes) || unicode.IsSpace(runes[i]) || runes[i] == '(' || runes[i] == ')'
+}
+
+// Check for a keyword starting at runes[i], returning its length
+func filterKeywordAt(runes []rune, i int) (filterTokenKind, int) {
+	for word, kind := range filterKeywords {
+		end := i + len(word)
+		if end > len(runes) || !strings.EqualFold(string(runes[i:end]), word) {
+			continue
 		}
 
-		if filter.colIdx == -1 {
-			return nil, fmt.Errorf("No such column: \"%s\"", column)
-		}
-
-		switch oper {
-		case "=", "==":
-			filter.cmpType = CmpEq
-		case "!=":
-			filter.cmpType = CmpNeq
-		case ">":
-			filter.cmpType = CmpGt
-		case ">=":
-			filter.cmpType = CmpGte
-		case "<":
-			filter.cmpType = CmpLt
-		case "<=":
-			filter.cmpType = CmpLte
-		case "~":
-			filter.cmpType = CmpMatch
-		case "!~":
-			filter.cmpType = CmpNoMatch
+		// "&&" and "||" don't need to be surrounded by whitespace
+		if unicode.IsLetter(runes[i]) && (!isFilterBoundary(runes, i-1) || !isFilterBoundary(runes, end)) {
+			continue
+		}
+
+		return kind, len(word)
+	}
+
+	return TokTerm, 0
+}
+
+// Split a filter expression into keywords, parentheses and the terms in
+// between. Terms can contain double quoted sections to escape any of
+// these.
+func tokenizeFilter(fs string) ([]filterToken, error) {
+	runes := []rune(fs)
+	tokens := []filterToken{}
+
+	for i := 0; i < len(runes); {
+		switch c := runes[i]; {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{TokOpen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{TokClose, ")", i})
+			i++
+		case c == '!' && (i+1 >= len(runes) || !strings.ContainsRune(OpChars, runes[i+1])):
+			tokens = append(tokens, filterToken{TokNot, "!", i})
+			i++
 		default:
-			return nil, fmt.Errorf("No such comparison operation: \"%s\"", oper)
+			if kind, length := filterKeywordAt(runes, i); length > 0 {
+				tokens = append(tokens, filterToken{kind, string(runes[i : i+length]), i})
+				i += length
+				continue
+			}
+
+			start := i
+			quoteStart := -1
+			var quote rune
+
+			for ; i < len(runes); i++ {
+				if quote != 0 {
+					if runes[i] == '\\' {
+						i++
+					} else if runes[i] == quote {
+						quote = 0
+					}
+				} else if runes[i] == '"' || runes[i] == '/' && followsMatchOp(runes[start:i]) {
+					quote = runes[i]
+					quoteStart = i
+				} else if !unicode.IsSpace(runes[i]) && followsMatchOp(runes[start:i]) {
+					i = skipFilterRegex(runes, i)
+					break
+				} else if runes[i] == '(' || runes[i] == ')' {
+					break
+				} else if length := nullTestAt(runes, i); length > 0 {
+					i += length
+					break
+				} else if _, length := filterKeywordAt(runes, i); length > 0 {
+					break
+				}
+			}
+
+			if quote == '"' {
+				return nil, &FilterError{fs, quoteStart, "Unterminated quote"}
+			} else if quote == '/' {
+				return nil, &FilterError{fs, quoteStart, "Unterminated regular expression"}
+			}
+
+			term := strings.TrimRightFunc(string(runes[start:i]), unicode.IsSpace)
+			tokens = append(tokens, filterToken{TokTerm, term, start})
+		}
+	}
+
+	return append(tokens, filterToken{TokEnd, "", len(runes)}), nil
+}
+
+// Length of "is null" or "is not null" starting at runes[i], if any
+func nullTestAt(runes []rune, i int) int {
+	if !isFilterBoundary(runes, i-1) {
+		return 0
+	}
+
+	match := nullTestRegex.FindString(string(runes[i:]))
+	if match == "" || !isFilterBoundary(runes, i+len([]rune(match))) {
+		return 0
+	}
+
+	return len([]rune(match))
+}
+
+// Index just past an unquoted regular expression starting at runes[i],
+// which runs until a keyword or a closing parenthesis outside of any group
+// or character class, so that "path ~ ^(a|b)$ and x > 1" works as written.
+func skipFilterRegex(runes []rune, i int) int {
+	depth := 0
+	inClass := false
+
+	for ; i < len(runes); i++ {
+		switch c := runes[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+
+			// A "]" right at the start is part of the class
+			if i+1 < len(runes) && runes[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(runes) && runes[i+1] == ']' {
+				i++
+			}
+		case c == '(':
+			depth++
+		case c == ')' && depth == 0:
+			return i
+		case c == ')':
+			depth--
+		case depth == 0:
+			if _, length := filterKeywordAt(runes, i); length > 0 && isFilterBoundary(runes, i-1) {
+				return i
+			}
+		}
+	}
+
+	return i
+}
+
+// Whether a term so far ends with "~", meaning a /regex/ may follow
+func followsMatchOp(term []rune) bool {
+	trimmed := strings.TrimRightFunc(string(term), unicode.IsSpace)
+	return strings.HasSuffix(trimmed, "~")
+}
+
+// Compile either a plain pattern or one written as /pattern/flags, where
+// flags can be any of "i", "m" and "s" (see regexp/syntax).
+func compileFilterRegex(value string) (*regexp.Regexp, error) {
+	if end := strings.LastIndex(value, "/"); strings.HasPrefix(value, "/") && end > 0 {
+		pattern, flags := value[1:end], value[end+1:]
+
+		if strings.Trim(flags, "ims") != "" {
+			return nil, fmt.Errorf("Unknown regular expression flags: \"%s\"", flags)
+		} else if flags != "" {
+			pattern = "(?" + flags + ")" + pattern
 		}
 
-		filter.value = value
-		if val, err := strconv.ParseFloat(value, 64); err == nil {
-			filter.valueFloat = val
+		return regexp.Compile(pattern)
+	}
+
+	return regexp.Compile(unquoteFilter(value))
+}
+
+// Remove double quotes (and backslash escapes within them)
+func unquoteFilter(s string) string {
+	var out strings.Builder
+	quoted := false
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '"' {
+			quoted = !quoted
+		} else if quoted && runes[i] == '\\' && i+1 < len(runes) {
+			i++
+			out.WriteRune(runes[i])
 		} else {
-			filter.valueFloat = math.NaN()
+			out.WriteRune(runes[i])
+		}
+	}
+
+	return out.String()
+}
+
+type filterParser struct {
+	ui         *UI
+	expression string
+	tokens     []filterToken
+	pos        int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != TokEnd {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) errorAt(pos int, format string, args ...interface{}) error {
+	return &FilterError{p.expression, pos, fmt.Sprintf(format, args...)}
+}
+
+// Source text from the given token up to (not including) the next one
+func (p *filterParser) sourceFrom(tok filterToken) string {
+	end := p.peek().pos
+	return strings.TrimSpace(string([]rune(p.expression)[tok.pos:end]))
+}
+
+// expr := and { "or" and }
+func (p *filterParser) parseOr() (Filter, error) {
+	first := p.peek()
+	filter, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []Filter{filter}
+	for p.peek().kind == TokOr {
+		p.next()
+		if filter, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return OrFilter{p.sourceFrom(first), filters}, nil
+}
+
+// and := not { "and" not }
+func (p *filterParser) parseAnd() (Filter, error) {
+	first := p.peek()
+	filter, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []Filter{filter}
+	for p.peek().kind == TokAnd {
+		p.next()
+		if filter, err = p.parseNot(); err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return AndFilter{p.sourceFrom(first), filters}, nil
+}
+
+// not := "not" not | "(" expr ")" | term
+func (p *filterParser) parseNot() (Filter, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case TokNot:
+		filter, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return NotFilter{p.sourceFrom(tok), filter}, nil
+	case TokOpen:
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if closing := p.next(); closing.kind != TokClose {
+			return nil, p.errorAt(closing.pos, "Expected a closing parenthesis for the one at position %d", tok.pos+1)
 		}
 
 		return filter, nil
+	case TokTerm:
+		return p.parseTerm(tok)
+	case TokEnd:
+		return nil, p.errorAt(tok.pos, "Expected a filter expression, not the end of input")
 	}
 
-	return nil, fmt.Errorf("Filter didn't match expected format: %v", CmpOpRegex)
+	return nil, p.errorAt(tok.pos, "Expected a filter expression, not \"%s\"", tok.text)
+}
+
+// Either "column CMP value", "column is [not] null" or a plain string to
+// look for in the row
+func (p *filterParser) parseTerm(tok filterToken) (Filter, error) {
+	runes := []rune(tok.text)
+
+	if match := nullTermRegex.FindStringSubmatch(tok.text); match != nil {
+		return p.parseNullTerm(tok, match[1], match[2] == "")
+	}
+
+	// Find the comparison operator, ignoring anything quoted
+	opStart, opEnd := -1, -1
+	quoted := false
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '"' {
+			quoted = !quoted
+		} else if quoted && runes[i] == '\\' {
+			i++
+		} else if !quoted && strings.ContainsRune(OpChars, runes[i]) {
+			opStart, opEnd = i, i
+			for opEnd < len(runes) && strings.ContainsRune(OpChars, runes[opEnd]) {
+				opEnd++
+			}
+			break
+		}
+	}
+
+	if opStart == -1 {
+		return RowFilter{
+			expression:    tok.text,
+			filter:        unquoteFilter(tok.text),
+			caseSensitive: false,
+		}, nil
+	}
+
+	filter := ColumnFilter{
+		expression: tok.text,
+	}
+
+	var (
+		column   = unquoteFilter(strings.TrimSpace(string(runes[:opStart])))
+		oper     = string(runes[opStart:opEnd])
+		rawValue = strings.TrimSpace(string(runes[opEnd:]))
+		value    = unquoteFilter(rawValue)
+		valuePos = tok.pos + len(runes) - len([]rune(rawValue))
+	)
+
+	if column == "" {
+		return nil, p.errorAt(tok.pos, "Expected a column name before \"%s\"", oper)
+	} else if value == "" {
+		return nil, p.errorAt(tok.pos+opEnd, "Expected a value after \"%s\"", oper)
+	}
+
+	colIdx, err := p.findColumn(tok, column)
+	if err != nil {
+		return nil, err
+	}
+
+	filter.colIdx = colIdx
+
+	switch oper {
+	case "=", "==":
+		filter.cmpType = CmpEq
+	case "!=":
+		filter.cmpType = CmpNeq
+	case ">":
+		filter.cmpType = CmpGt
+	case ">=":
+		filter.cmpType = CmpGte
+	case "<":
+		filter.cmpType = CmpLt
+	case "<=":
+		filter.cmpType = CmpLte
+	case "~":
+		filter.cmpType = CmpMatch
+	case "!~":
+		filter.cmpType = CmpNoMatch
+	default:
+		return nil, p.errorAt(tok.pos+opStart, "No such comparison operation: \"%s\"", oper)
+	}
+
+	filter.value = value
+
+	if filter.cmpType == CmpMatch || filter.cmpType == CmpNoMatch {
+		regex, err := compileFilterRegex(rawValue)
+		if err != nil {
+			return nil, p.errorAt(valuePos, "Invalid regular expression: %v", err)
+		}
+
+		filter.regex = regex
+		filter.valueFloat = math.NaN()
+	} else if val, err := strconv.ParseFloat(value, 64); err == nil {
+		filter.valueFloat = val
+	} else {
+		filter.valueFloat = math.NaN()
+	}
+
+	return filter, nil
+}
+
+func (p *filterParser) findColumn(tok filterToken, column string) (int, error) {
+	for i, col := range p.ui.columns {
+		if col.Name == column {
+			return i, nil
+		}
+	}
+
+	return -1, p.errorAt(tok.pos, "No such column: \"%s\"", column)
+}
+
+func (p *filterParser) parseNullTerm(tok filterToken, column string, isNull bool) (Filter, error) {
+	column = unquoteFilter(strings.TrimSpace(column))
+	if column == "" {
+		return nil, p.errorAt(tok.pos, "Expected a column name before \"is\"")
+	}
+
+	colIdx, err := p.findColumn(tok, column)
+	if err != nil {
+		return nil, err
+	}
+
+	return NullFilter{tok.text, colIdx, isNull}, nil
+}
+
+// parse a filter string into an instance of the Filter interface
+func (ui *UI) parseFilter(fs string) (Filter, error) {
+	tokens, err := tokenizeFilter(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{ui: ui, expression: fs, tokens: tokens}
+
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != TokEnd {
+		return nil, p.errorAt(tok.pos, "Unexpected \"%s\"", tok.text)
+	}
+
+	return filter, nil
 }
 
 func (f ColumnFilter) String() string { return f.expression }
 func (f ColumnFilter) Matches(row []string) bool {
 	valStr := row[f.colIdx]
 
+	// Like SQL, comparing anything with NULL is never true
+	if valStr == Null {
+		return false
+	}
+
+	// Regular expressions always match against the text of the cell
+	if f.regex != nil {
+		return f.regex.MatchString(valStr) == (f.cmpType == CmpMatch)
+	}
+
 	if math.IsNaN(f.valueFloat) {
 		switch f.cmpType {
 		case CmpEq:
@@ -152,16 +636,12 @@ func (f ColumnFilter) Matches(row []string) bool {
 			return valStr < f.value
 		case CmpLte:
 			return valStr <= f.value
-		case CmpMatch:
-			return strings.Contains(valStr, f.value)
-		case CmpNoMatch:
-			return !strings.Contains(valStr, f.value)
 		}
 	} else if val, err := strconv.ParseFloat(strings.TrimSpace(valStr), 64); err == nil {
 		switch f.cmpType {
-		case CmpEq, CmpMatch:
+		case CmpEq:
 			return val == f.valueFloat
-		case CmpNeq, CmpNoMatch:
+		case CmpNeq:
 			return val != f.valueFloat
 		case CmpGt:
 			return val > f.valueFloat
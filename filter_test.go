@@ -0,0 +1,118 @@
+package vxsv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeFilter(t *testing.T) {
+	tests := []struct {
+		expr  string
+		kinds []filterTokenKind
+		terms []string
+	}{
+		{"a == 1", []filterTokenKind{TokTerm}, []string{"a == 1"}},
+		{"a == 1 and b != 2", []filterTokenKind{TokTerm, TokAnd, TokTerm}, []string{"a == 1", "b != 2"}},
+		{"a==1&&b==2", []filterTokenKind{TokTerm, TokAnd, TokTerm}, []string{"a==1", "b==2"}},
+		{"not (a > 1 or b < 2)", []filterTokenKind{TokNot, TokOpen, TokTerm, TokOr, TokTerm, TokClose}, []string{"a > 1", "b < 2"}},
+		{"!(a == 1)", []filterTokenKind{TokNot, TokOpen, TokTerm, TokClose}, []string{"a == 1"}},
+		{`name == "x and (y)"`, []filterTokenKind{TokTerm}, []string{`name == "x and (y)"`}},
+		{"brand == android", []filterTokenKind{TokTerm}, []string{"brand == android"}},
+		{"a is null or b is not null", []filterTokenKind{TokTerm, TokOr, TokTerm}, []string{"a is null", "b is not null"}},
+		{"path ~ /a|b (c)/i", []filterTokenKind{TokTerm}, []string{"path ~ /a|b (c)/i"}},
+		{"path ~ ^(a|b)$", []filterTokenKind{TokTerm}, []string{"path ~ ^(a|b)$"}},
+		{"path ~ ^(a||b)$ or x > 1", []filterTokenKind{TokTerm, TokOr, TokTerm}, []string{"path ~ ^(a||b)$", "x > 1"}},
+		{"(path !~ [()]x and y == 1)", []filterTokenKind{TokOpen, TokTerm, TokAnd, TokTerm, TokClose}, []string{"path !~ [()]x", "y == 1"}},
+		{`path ~ \(a\) || x > 1`, []filterTokenKind{TokTerm, TokOr, TokTerm}, []string{`path ~ \(a\)`, "x > 1"}},
+	}
+
+	for _, test := range tests {
+		tokens, err := tokenizeFilter(test.expr)
+		if err != nil {
+			t.Errorf("tokenizeFilter(%q): %v", test.expr, err)
+			continue
+		}
+
+		kinds := []filterTokenKind{}
+		terms := []string{}
+
+		for _, tok := range tokens[:len(tokens)-1] {
+			kinds = append(kinds, tok.kind)
+			if tok.kind == TokTerm {
+				terms = append(terms, tok.text)
+			}
+		}
+
+		if !reflect.DeepEqual(kinds, test.kinds) || !reflect.DeepEqual(terms, test.terms) {
+			t.Errorf("tokenizeFilter(%q) = %v %q, want %v %q", test.expr, kinds, terms, test.kinds, test.terms)
+		}
+	}
+}
+
+func TestTokenizeFilterErrors(t *testing.T) {
+	for _, expr := range []string{`a == "x`, "path ~ /abc"} {
+		if _, err := tokenizeFilter(expr); err == nil {
+			t.Errorf("tokenizeFilter(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	ui := &UI{columns: []Column{{Name: "path"}, {Name: "status"}, {Name: "note"}}}
+
+	rows := [][]string{
+		{"/a", "200", ""},
+		{"/b", "500", Null},
+		{"/c", "404", "x"},
+	}
+
+	tests := []struct {
+		expr    string
+		matches []bool
+	}{
+		{"status == 200", []bool{true, false, false}},
+		{"status >= 404", []bool{false, true, true}},
+		{"status > 200 and path != /c", []bool{false, true, false}},
+		{"status == 200 or status == 404", []bool{true, false, true}},
+		{"not (status == 200 or status == 404)", []bool{false, true, false}},
+		{"!status == 500", []bool{true, false, true}},
+		{"path ~ ^/(a|b)$", []bool{true, true, false}},
+		{"path ~ /^\\/A$/i", []bool{true, false, false}},
+		{"path !~ ^/(a|b)$ || status == 200", []bool{true, false, true}},
+		{"(path ~ ^/(b|c)$) and status < 500", []bool{false, false, true}},
+		{"note is null", []bool{false, true, false}},
+		{"note is not null and note != x", []bool{true, false, false}},
+		{"status == 200 or note == x", []bool{true, false, true}},
+	}
+
+	for _, test := range tests {
+		filter, err := ui.parseFilter(test.expr)
+		if err != nil {
+			t.Errorf("parseFilter(%q): %v", test.expr, err)
+			continue
+		}
+
+		for i, row := range rows {
+			if got := filter.Matches(row); got != test.matches[i] {
+				t.Errorf("parseFilter(%q).Matches(%q) = %v, want %v", test.expr, row, got, test.matches[i])
+			}
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	ui := &UI{columns: []Column{{Name: "path"}, {Name: "status"}}}
+
+	for _, expr := range []string{
+		"nope == 1",
+		"status == 1 and",
+		"(status == 1",
+		"status == 1)",
+		"path ~ ^(a$",
+		"path ~ /a/x",
+	} {
+		if _, err := ui.parseFilter(expr); err == nil {
+			t.Errorf("parseFilter(%q) succeeded, want an error", expr)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Reading whitespace aligned tables, such as the output of docker ps,
+// kubectl get or ps aux.
+
+package vxsv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How many lines are looked at to find the columns
+const fixedSampleLines = 1000
+
+// Find where the columns start from the gutters of spaces running down
+// the lines. A few lines that overflow into a gutter are tolerated, as ps
+// does when a number is wider than usual.
+//
+// With a header, stretches that have nothing in the header above them
+// are part of the column to their left, such as the arguments of a
+// COMMAND. So are names with nothing below them that are only a single
+// space away from the previous one, like the "on" of "Mounted on", but a
+// name set apart by a proper gutter is a column even when it's empty.
+func inferColumnStarts(lines []string, header bool) []int {
+	counts := []int{}
+	named := []bool{}
+	filled := []bool{}
+
+	for i, line := range lines {
+		display := newDisplayLine(line)
+
+		for pos := 0; pos < len(display.offsets)-1; pos++ {
+			for len(counts) <= pos {
+				counts = append(counts, 0)
+				named = append(named, false)
+				filled = append(filled, false)
+			}
+
+			if display.at(pos) == ' ' {
+				continue
+			}
+
+			counts[pos]++
+
+			if i == 0 && header {
+				named[pos] = true
+			} else {
+				filled[pos] = true
+			}
+		}
+	}
+
+	// The header is never overflow, however few lines are below it
+	occupied := make([]bool, len(counts))
+	for pos, count := range counts {
+		occupied[pos] = named[pos] || count > len(lines)/20
+	}
+
+	starts := []int{}
+	prevEnd := 0
+
+	for pos := 0; pos < len(occupied); pos++ {
+		if !occupied[pos] || (pos > 0 && occupied[pos-1]) {
+			continue
+		}
+
+		end := pos
+		for end < len(occupied) && occupied[end] {
+			end++
+		}
+
+		isNamed := anyTrue(named[pos:end])
+		isColumn := len(starts) == 0 || !header || len(lines) == 1 ||
+			(isNamed && (anyTrue(filled[pos:end]) || pos-prevEnd >= 2))
+
+		if isColumn {
+			starts = append(starts, pos)
+		}
+
+		prevEnd = end
+	}
+
+	return starts
+}
+
+func anyTrue(values []bool) bool {
+	for _, v := range values {
+		if v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Column starts for explicitly given widths, the last column takes up
+// the rest of the line.
+func widthStarts(widths []int) []int {
+	starts := make([]int, len(widths))
+
+	for i := 1; i < len(widths); i++ {
+		starts[i] = starts[i-1] + widths[i-1]
+	}
+
+	return starts
+}
+
+// Cut a line up into columns at the given starts. With snap set, a value
+// straddling the start of a column, such as a number wider than any seen
+// before, is kept in one piece and goes to whichever side most of it is
+// on.
+func splitFixed(starts []int, line string, snap bool) []string {
+	display := newDisplayLine(line)
+	end := len(display.offsets) - 1
+
+	cuts := make([]int, len(starts)+1)
+	cuts[len(starts)] = end
+
+	for i := 1; i < len(starts); i++ {
+		cut := clamp(starts[i], cuts[i-1], end)
+
+		if snap && display.at(cut-1) != ' ' && display.at(cut) != ' ' {
+			first, last := cut, cut
+			for first > cuts[i-1] && display.at(first-1) != ' ' {
+				first--
+			}
+			for last < end && display.at(last) != ' ' {
+				last++
+			}
+
+			if first > cuts[i-1] && cut-first < last-cut {
+				cut = first
+			} else {
+				cut = last
+			}
+		}
+
+		cuts[i] = cut
+	}
+
+	row := make([]string, len(starts))
+	for i := range starts {
+		row[i] = strings.TrimSpace(display.slice(cuts[i], cuts[i+1]))
+	}
+
+	return row
+}
+
+type fixedLine struct {
+	text string
+	end  int64
+	err  error // Set on the last line sent
+}
+
+type fixedRecords struct {
+	lines   <-chan fixedLine
+	starts  []int
+	snap    bool
+	pending []fixedLine // Read ahead to find the columns
+}
+
+// Read the lines that aren't blank in a goroutine, so that finding the
+// columns can stop waiting on a slow stream.
+func readFixedLines(reader io.Reader) <-chan fixedLine {
+	lines := newLineReader(reader)
+	out := make(chan fixedLine, 1024)
+
+	go func() {
+		defer close(out)
+
+		for {
+			line, err := lines.ReadLine()
+			if err != nil {
+				out <- fixedLine{err: err}
+				return
+			} else if strings.TrimSpace(line) != "" {
+				out <- fixedLine{text: line, end: lines.offset}
+			}
+		}
+	}()
+
+	return out
+}
+
+// Read ahead up to fixedSampleLines lines, waiting for the first one and
+// then at most wait for the rest, like peekInput.
+func (r *fixedRecords) sample(wait time.Duration) error {
+	var timeout <-chan time.Time
+
+	for len(r.pending) < fixedSampleLines {
+		select {
+		case line, ok := <-r.lines:
+			if !ok || line.err == io.EOF {
+				return nil
+			} else if line.err != nil {
+				return line.err
+			}
+
+			r.pending = append(r.pending, line)
+		case <-timeout:
+			return nil
+		}
+
+		if timeout == nil {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+
+			timeout = timer.C
+		}
+	}
+
+	return nil
+}
+
+// Next line that isn't blank, along with the offset just past it
+func (r *fixedRecords) nextLine() (string, int64, error) {
+	if len(r.pending) > 0 {
+		line := r.pending[0]
+		r.pending = r.pending[1:]
+
+		return line.text, line.end, nil
+	}
+
+	return r.readLine()
+}
+
+// Like nextLine, skipping over any lines read ahead
+func (r *fixedRecords) readLine() (string, int64, error) {
+	line, ok := <-r.lines
+	if !ok {
+		return "", 0, io.EOF
+	}
+
+	return line.text, line.end, line.err
+}
+
+func (r *fixedRecords) Read() ([]string, int64, error) {
+	line, end, err := r.nextLine()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return splitFixed(r.starts, line, r.snap), end, nil
+}
+
+// Parse a list of column widths, e.g. "8,12,5"
+func ParseWidths(list string) ([]int, error) {
+	widths := []int{}
+
+	for _, str := range strings.Split(list, ",") {
+		width, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil || width <= 0 {
+			return nil, fmt.Errorf("Invalid column width: \"%s\"", str)
+		}
+
+		widths = append(widths, width)
+	}
+
+	return widths, nil
+}
+
+// Reads a table with its columns lined up using spaces. Unless widths are
+// given, the columns are found from the header and up to a thousand lines
+// that arrive along with it, see inferColumnStarts. Blank lines are
+// skipped.
+func ReadFixedWidth(reader io.Reader, widths []int, readHeader bool, count int64) (RowSource, error) {
+	records := &fixedRecords{}
+
+	source := newStreamSource(reader, func(buf []byte) ([]string, error) {
+		// Any blank lines before the record are included
+		line := strings.TrimRight(string(buf), "\r\n")
+		line = line[strings.LastIndex(line, "\n")+1:]
+
+		return splitFixed(records.starts, line, records.snap), nil
+	})
+
+	// Slow streams (kubectl get -w) have the columns found from what
+	// arrives within a moment, the rest is split up the same way
+	records.lines = readFixedLines(reader)
+	if err := records.sample(peekWait); err != nil {
+		return nil, err
+	}
+
+	if len(records.pending) == 0 {
+		return nil, errors.New("No lines found in input")
+	}
+
+	start := int64(0)
+	if readHeader {
+		start = records.pending[0].end
+	}
+
+	if len(widths) > 0 {
+		records.starts = widthStarts(widths)
+	} else {
+		sample := make([]string, len(records.pending))
+		for i, line := range records.pending {
+			sample[i] = line.text
+		}
+
+		records.starts = inferColumnStarts(sample, readHeader)
+		records.snap = true
+	}
+
+	columns := make([]Column, len(records.starts))
+
+	if readHeader {
+		names := splitFixed(records.starts, records.pending[0].text, records.snap)
+		records.pending = records.pending[1:]
+
+		for i, name := range names {
+			columns[i] = Column{Name: name, Width: displayWidth(name)}
+		}
+	} else {
+		for i := range columns {
+			name := fmt.Sprintf("[%d]", i)
+			columns[i] = Column{Name: name, Width: len(name)}
+		}
+	}
+
+	source.begin(columns, start)
+	go source.load(records, count)
+
+	return source, nil
+}
@@ -0,0 +1,170 @@
+package vxsv
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestInferColumnStarts(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		header bool
+		want   [][]string // The header and first row, split at the starts found
+	}{
+		{
+			"docker ps with an empty column",
+			[]string{
+				"CONTAINER ID   IMAGE     COMMAND    CREATED       STATUS        PORTS     NAMES",
+				"a1b2c3d4e5f6   nginx     \"nginx\"    2 hours ago   Up 2 hours              web",
+				"f6e5d4c3b2a1   redis:7   \"redis\"    3 days ago    Exited (0)              cache",
+			},
+			true,
+			[][]string{
+				{"CONTAINER ID", "IMAGE", "COMMAND", "CREATED", "STATUS", "PORTS", "NAMES"},
+				{"a1b2c3d4e5f6", "nginx", "\"nginx\"", "2 hours ago", "Up 2 hours", "", "web"},
+			},
+		},
+		{
+			"df",
+			[]string{
+				"Filesystem      Size  Used Avail Use% Mounted on",
+				"/dev/sda1        50G   20G   28G  42% /",
+				"tmpfs           7.8G     0  7.8G   0% /dev/shm",
+			},
+			true,
+			[][]string{
+				{"Filesystem", "Size", "Used", "Avail", "Use%", "Mounted on"},
+				{"/dev/sda1", "50G", "20G", "28G", "42%", "/"},
+			},
+		},
+		{
+			"arguments of a command",
+			[]string{
+				"PID   CMD",
+				"1     init splash",
+				"42    sleep 10",
+			},
+			true,
+			[][]string{
+				{"PID", "CMD"},
+				{"1", "init splash"},
+			},
+		},
+		{
+			"kubectl with a value running into the next column",
+			[]string{
+				"NAME                     READY   STATUS    RESTARTS   AGE",
+				"web-7d4b9c8f5-abcde      1/1     Running   0          5d",
+				"db-0                     1/1     Running   2 (3h ago) 10d",
+			},
+			true,
+			[][]string{
+				{"NAME", "READY", "STATUS", "RESTARTS", "AGE"},
+				{"web-7d4b9c8f5-abcde", "1/1", "Running", "0", "5d"},
+			},
+		},
+		{
+			"without a header",
+			[]string{
+				"alpha   1   x",
+				"beta    22  y",
+			},
+			false,
+			[][]string{
+				{"alpha", "1", "x"},
+				{"beta", "22", "y"},
+			},
+		},
+		{
+			"wide characters",
+			[]string{
+				"名前    AGE",
+				"日本語  3",
+			},
+			true,
+			[][]string{
+				{"名前", "AGE"},
+				{"日本語", "3"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		starts := inferColumnStarts(test.lines, test.header)
+
+		got := [][]string{}
+		for _, line := range test.lines[:2] {
+			got = append(got, splitFixed(starts, line, true))
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: columns start at %v, splitting into %q, want %q", test.name, starts, got, test.want)
+		}
+	}
+}
+
+func TestParseWidths(t *testing.T) {
+	widths, err := ParseWidths("8, 12,5")
+	if err != nil || !reflect.DeepEqual(widths, []int{8, 12, 5}) {
+		t.Errorf("ParseWidths(\"8, 12,5\") = %v, %v", widths, err)
+	}
+
+	for _, list := range []string{"", "8,", "8abc", "0", "-3", "8,x"} {
+		if _, err := ParseWidths(list); err == nil {
+			t.Errorf("ParseWidths(%q) succeeded, want an error", list)
+		}
+	}
+}
+
+func TestSplitFixed(t *testing.T) {
+	starts := []int{0, 6, 12}
+
+	tests := []struct {
+		line string
+		snap bool
+		want []string
+	}{
+		{"abc   def   ghi jkl", true, []string{"abc", "def", "ghi jkl"}},
+		{"abc", true, []string{"abc", "", ""}},
+		{"abc   12345678 x", true, []string{"abc", "12345678", "x"}},
+		{"abcdefgh    x", true, []string{"abcdefgh", "", "x"}},
+		{"abcdefgh    x", false, []string{"abcdef", "gh", "x"}},
+		{"日本語 def   x", true, []string{"日本語", "def", "x"}},
+	}
+
+	for _, test := range tests {
+		if got := splitFixed(starts, test.line, test.snap); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitFixed(%v, %q, %v) = %q, want %q", starts, test.line, test.snap, got, test.want)
+		}
+	}
+}
+
+// The columns of a stream that's slow to arrive are found from the first
+// lines, without waiting for more
+func TestReadFixedWidthStream(t *testing.T) {
+	pr, pw := io.Pipe()
+
+	go pw.Write([]byte("NAME    READY\nweb-1   1/1\n"))
+
+	source, err := ReadFixedWidth(pr, nil, true, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		pw.Write([]byte("\ndb-0    0/1\n"))
+		pw.Close()
+	}()
+
+	names, rows := readSource(t, source)
+
+	if want := []string{"NAME", "READY"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("columns %q, want %q", names, want)
+	}
+
+	if want := [][]string{{"web-1", "1/1"}, {"db-0", "0/1"}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows %q, want %q", rows, want)
+	}
+}
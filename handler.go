@@ -4,13 +4,13 @@ package vxsv
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math"
 	"os/exec"
-	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -30,25 +30,28 @@ type HandlerDefault struct {
 
 func (h *HandlerDefault) Repaint() {
 	ui := h.ui
-	ui.writeModeLine(":", []string{})
+
+	if ui.search != nil {
+		ui.writeModeLine(":", []string{"/" + ui.search.text, ui.search.Status()})
+	} else {
+		ui.writeModeLine(":", []string{})
+	}
 }
 
 func (h *HandlerDefault) HandleKey(ev termbox.Event) {
 	ui := h.ui
-	vw, vh := ui.viewSize()
+	_, vh := ui.viewSize()
 
-	maxYOffset := clamp(len(ui.filterMatches)-(vh-2), 0, len(ui.filterMatches)-1)
-	lastColumnOffset, colWidth := ui.columnOffset(len(ui.columns) - 1)
-	endOfLine := (lastColumnOffset + colWidth) - vw
-
-	// prevent funky scrolling behavior when row is smaller than screen
-	if endOfLine < 0 {
-		endOfLine = 0
-	}
+	maxYOffset := ui.maxOffsetY()
+	endOfLine := ui.maxOffsetX()
 
 	switch {
 	case ev.Key == termbox.KeyCtrlL:
 		termbox.Sync()
+	case ev.Key == termbox.KeyCtrlG:
+		if source, ok := ui.input.(cancelable); ok {
+			source.Cancel()
+		}
 	case ev.Key == termbox.KeyCtrlA:
 		ui.offsetX = 0
 	case ev.Key == termbox.KeyCtrlE:
@@ -64,6 +67,31 @@ func (h *HandlerDefault) HandleKey(ev termbox.Event) {
 	case ev.Ch == '/', ev.Key == termbox.KeyCtrlR:
 		ui.pushHandler(&HandlerFilter{*h, ui.filter.String()})
 		ui.offsetY = 0
+	case ev.Ch == ':':
+		ui.pushHandler(&HandlerCommand{*h, ""})
+	case ev.Ch == 'f', ev.Key == termbox.KeyCtrlF:
+		text := ""
+		if ui.search != nil {
+			text = ui.search.text
+		}
+
+		ui.pushHandler(&HandlerSearch{*h, text})
+	case ev.Ch == 'n':
+		ui.nextMatch(1)
+	case ev.Ch == 'N':
+		ui.nextMatch(-1)
+	case ev.Key == termbox.KeyEsc:
+		ui.search = nil
+	case ev.Ch == '[':
+		ui.switchTable(-1)
+	case ev.Ch == ']':
+		ui.switchTable(1)
+	case ev.Ch == 'M':
+		ui.showMessages()
+	case ev.Ch == 'P':
+		ui.showProblems()
+	case ev.Ch == 'T':
+		ui.ShowTablePicker()
 	case ev.Key == termbox.KeySpace:
 		ui.offsetY = clamp(ui.offsetY+vh, 0, maxYOffset)
 	case unicode.ToLower(ev.Ch) == 'c':
@@ -71,6 +99,8 @@ func (h *HandlerDefault) HandleKey(ev termbox.Event) {
 		ui.offsetX = 0
 	case unicode.ToLower(ev.Ch) == 'r':
 		ui.pushHandler(&HandlerRowSelect{*h, h.ui.offsetY})
+	case unicode.ToLower(ev.Ch) == 'v':
+		ui.pushHandler(NewCellSelect(h.ui))
 	case ev.Ch == 'G':
 		ui.offsetY = maxYOffset
 	case ev.Ch == 'g':
@@ -100,17 +130,22 @@ type HandlerFilter struct {
 }
 
 func (h *HandlerFilter) Repaint() {
-	ui := h.ui
-	_, height := termbox.Size()
+	h.ui.writeModeLine("Filter", []string{h.filter})
+	setPromptCursor("Filter", h.filter)
+}
 
-	ui.writeModeLine("Filter", []string{h.filter})
-	termbox.SetCursor(len("filter")+1+len(h.filter), height-1)
+// Put the cursor after the text typed at a prompt, which is drawn after
+// the mode label by writeModeLine.
+func setPromptCursor(label, text string) {
+	_, height := termbox.Size()
+	termbox.SetCursor(displayWidth(label)+1+displayWidth(text), height-1)
 }
 
 func handlePromptKey(ev termbox.Event, str *string) (consumed bool) {
 	if ev.Key == termbox.KeyDelete || ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2 {
-		if sz := len(*str); sz > 0 {
-			*str = (*str)[:sz-1]
+		// Remove the whole character, not just its last byte
+		if gs := glyphs(*str); len(gs) > 0 {
+			*str = (*str)[:len(*str)-len(gs[len(gs)-1].text)]
 		}
 	} else if ev.Key == termbox.KeyCtrlW || ev.Key == termbox.KeyCtrlU {
 		*str = ""
@@ -133,20 +168,22 @@ func (h *HandlerFilter) HandleKey(ev termbox.Event) {
 		return
 	} else if ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlG {
 		ui.popHandler()
-
-		ui.filter = EmptyFilter{}
-		ui.filterRows()
+		ui.filterRows(EmptyFilter{})
 	} else if ev.Key == termbox.KeyEnter {
-		if h.filter == "" {
-			ui.filter = EmptyFilter{}
-		} else if filter, err := ui.parseFilter(h.filter); err == nil {
-			ui.filter = filter
-		} else {
-			ui.pushErrorPopup("There was an error in your filter: "+h.filter, err)
-			return
+		var filter Filter = EmptyFilter{}
+
+		if h.filter != "" {
+			parsed, err := ui.parseFilter(h.filter)
+			if err != nil {
+				ui.pushErrorPopup("There was an error in your filter", err)
+				return
+			}
+
+			filter = parsed
 		}
-		ui.filterRows()
+
 		ui.popHandler()
+		ui.filterRows(filter)
 	} else {
 		// Fallback to default handling for arrows etc
 		// FIXME: is this really the best way to do this in go?
@@ -155,14 +192,147 @@ func (h *HandlerFilter) HandleKey(ev termbox.Event) {
 	}
 }
 
+type HandlerSearch struct {
+	HandlerDefault
+	search string
+}
+
+func (h *HandlerSearch) Repaint() {
+	h.ui.writeModeLine("Search", []string{h.search})
+	setPromptCursor("Search", h.search)
+}
+
+func (h *HandlerSearch) HandleKey(ev termbox.Event) {
+	ui := h.ui
+
+	if handlePromptKey(ev, &h.search) {
+		return
+	} else if ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlG {
+		ui.popHandler()
+		ui.search = nil
+	} else if ev.Key == termbox.KeyEnter {
+		ui.popHandler()
+
+		if h.search == "" {
+			ui.search = nil
+			return
+		}
+
+		search, err := NewSearch(h.search)
+		if err != nil {
+			ui.pushErrorPopup("There was an error in your search: "+h.search, err)
+			return
+		}
+
+		ui.runSearch(search, 1)
+	}
+}
+
+// Prompt for ex style commands, e.g. ":w out.csv"
+type HandlerCommand struct {
+	HandlerDefault
+	command string
+}
+
+func (h *HandlerCommand) Repaint() {
+	h.ui.writeModeLine(":", []string{h.command})
+	setPromptCursor(":", h.command)
+}
+
+func (h *HandlerCommand) HandleKey(ev termbox.Event) {
+	ui := h.ui
+
+	if handlePromptKey(ev, &h.command) {
+		return
+	} else if ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlG {
+		ui.popHandler()
+	} else if ev.Key == termbox.KeyEnter {
+		ui.popHandler()
+
+		if err := h.run(); err != nil {
+			ui.pushErrorPopup("Invalid command: "+h.command, err)
+		}
+	}
+}
+
+func (h *HandlerCommand) run() error {
+	args := strings.Fields(h.command)
+	if len(args) == 0 {
+		return nil
+	}
+
+	switch args[0] {
+	case "w", "w!", "write", "write!":
+		force := strings.HasSuffix(args[0], "!")
+
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("usage: %s PATH [FORMAT]", args[0])
+		}
+
+		path := args[1]
+		format := ExportFormatForPath(path)
+
+		if len(args) == 3 {
+			var err error
+			if format, err = ParseExportFormat(args[2]); err != nil {
+				return err
+			}
+		}
+
+		h.ui.exportView(path, format, force)
+		return nil
+	case "query":
+		query := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(h.command), args[0]))
+		if query == "" {
+			return fmt.Errorf("usage: %s SQL", args[0])
+		}
+
+		return h.ui.runQuery(query)
+	}
+
+	return fmt.Errorf("Unknown command \"%s\"", args[0])
+}
+
 type HandlerShell struct {
 	HandlerDefault
 	colIdx  int
 	command string
 }
 
+// Run the command in the background, replacing the column's values with
+// its output once it's done.
 func (h *HandlerShell) applyCommand() {
-	cmd := exec.Command("sh", "-c", h.command)
+	ui, colIdx, command := h.ui, h.colIdx, h.command
+
+	ui.runTask("Running shell command", ui.loaded, func(t *Task) func() {
+		values, err := ui.runShellCommand(colIdx, command, t)
+		if t.Cancelled() {
+			return nil
+		}
+
+		width, ok := ui.measureColumn(colIdx, values, t)
+		if !ok {
+			return nil
+		}
+
+		return func() {
+			col := &ui.columns[colIdx]
+			col.Modified = true
+			col.ModifiedValues = values
+			col.ModifiedCommand = command
+			col.Width = width
+
+			if err != nil {
+				ui.pushErrorPopup("There was an error running your command:", err)
+			}
+		}
+	})
+}
+
+// Pipe the values of a column through a shell command, one per line,
+// returning a line of output for each loaded row.
+func (ui *UI) runShellCommand(colIdx int, command string, t *Task) ([]string, error) {
+	cmd := exec.Command("sh", "-c", command)
 
 	in, err := cmd.StdinPipe()
 	if err != nil {
@@ -182,12 +352,21 @@ func (h *HandlerShell) applyCommand() {
 		panic(err)
 	}
 
+	written := make(chan struct{})
+
 	go func() {
+		defer close(written)
 		defer in.Close()
 
-		for i := range h.ui.rows {
-			row := h.ui.getRow(i)
-			io.WriteString(in, row[h.colIdx]+"\n")
+		for i := 0; i < ui.loaded && !t.Cancelled(); i++ {
+			value := ui.getRow(i)[colIdx]
+			if value == Null {
+				value = ""
+			}
+
+			if _, err := io.WriteString(in, value+"\n"); err != nil {
+				return
+			}
 		}
 	}()
 
@@ -195,35 +374,45 @@ func (h *HandlerShell) applyCommand() {
 		panic(err)
 	}
 
-	modifiedColumn := make([]string, len(h.ui.rows))
+	// Rows must not be read once the task is over, and the command may
+	// not have read all of them
+	defer func() {
+		in.Close()
+		<-written
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	modifiedColumn := make([]string, ui.loaded)
 
 	scanner := bufio.NewScanner(out)
-	for i := 0; i < len(h.ui.rows); i++ {
-		if !scanner.Scan() {
-			output, _ := ioutil.ReadAll(errOut)
-			h.ui.pushErrorPopup("Process exited too early!", fmt.Errorf("%s", output))
-			break
+	for i := 0; i < ui.loaded; i++ {
+		if t.Cancelled() {
+			return nil, nil
 		}
 
-		if err := scanner.Err(); err != nil {
-			h.ui.pushErrorPopup("There was an error running your command:", err)
-			break
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return modifiedColumn, err
+			}
+
+			output, _ := ioutil.ReadAll(errOut)
+			return modifiedColumn, fmt.Errorf("Process exited too early!\n\n%s", output)
 		}
 
 		modifiedColumn[i] = scanner.Text()
+		t.Step()
 	}
 
-	h.ui.columns[h.colIdx].Modified = true
-	h.ui.columns[h.colIdx].ModifiedValues = modifiedColumn
-	h.ui.columns[h.colIdx].ModifiedCommand = h.command
+	return modifiedColumn, nil
 }
 
 func (h *HandlerShell) HandleKey(ev termbox.Event) {
 	if handlePromptKey(ev, &h.command) {
 		return
 	} else if ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlG {
-		h.ui.columns[h.colIdx].Modified = false
 		h.ui.popHandler()
+		h.restoreColumn()
 	} else if ev.Key == termbox.KeyEnter {
 		trimmed := strings.TrimSpace(h.command)
 		h.ui.popHandler()
@@ -231,18 +420,22 @@ func (h *HandlerShell) HandleKey(ev termbox.Event) {
 		if len(trimmed) > 0 {
 			h.applyCommand()
 		} else {
-			h.ui.columns[h.colIdx].Modified = false
+			h.restoreColumn()
 		}
 	}
+}
 
-	h.ui.recomputeColumnWidth(h.colIdx)
+// Go back to the column's own values
+func (h *HandlerShell) restoreColumn() {
+	if col := &h.ui.columns[h.colIdx]; col.Modified {
+		col.Modified = false
+		h.ui.recomputeColumnWidth(h.colIdx)
+	}
 }
 
 func (h *HandlerShell) Repaint() {
-	_, height := termbox.Size()
-
 	h.ui.writeModeLine("Run shell", []string{h.command})
-	termbox.SetCursor(len("run shell")+1+len(h.command), height-1)
+	setPromptCursor("Run shell", h.command)
 }
 
 type HandlerRowSelect struct {
@@ -261,30 +454,7 @@ func (h *HandlerRowSelect) HandleKey(ev termbox.Event) {
 	case termbox.KeyArrowDown:
 		h.rowIdx = clamp(h.rowIdx+1, 0, len(ui.filterMatches)-1)
 	case termbox.KeyEnter:
-		jsonObj := make(map[string]interface{})
-
-		rowIdx := ui.filterMatches[h.rowIdx]
-		row := ui.getRow(rowIdx)
-
-		for i, col := range ui.columns {
-			str := row[i]
-
-			if v, err := strconv.ParseInt(str, 10, 64); err == nil {
-				jsonObj[col.Name] = v
-			} else if v, err := strconv.ParseFloat(str, 64); err == nil {
-				jsonObj[col.Name] = v
-			} else if v, err := strconv.ParseBool(str); err == nil {
-				jsonObj[col.Name] = v
-			} else {
-				jsonObj[col.Name] = str
-			}
-		}
-
-		if jsonStr, err := json.MarshalIndent(jsonObj, "", "  "); err == nil {
-			ui.pushHandler(NewPopup(ui, string(jsonStr)))
-		} else {
-			ui.pushErrorPopup("Failed to dump row as json (this is a bug)", err)
-		}
+		ui.showRowDetail(ui.filterMatches[h.rowIdx])
 	default:
 		def := &HandlerDefault{ui}
 		def.HandleKey(ev)
@@ -298,6 +468,10 @@ func (h *HandlerRowSelect) HandleKey(ev termbox.Event) {
 	}
 }
 
+func (h *HandlerRowSelect) Resize() {
+	h.ui.scrollToRow(h.rowIdx)
+}
+
 func (h *HandlerRowSelect) Repaint() {
 	ui := h.ui
 
@@ -305,6 +479,159 @@ func (h *HandlerRowSelect) Repaint() {
 	ui.writeModeLine("Row Select", []string{strconv.Itoa(h.rowIdx)})
 }
 
+// Sources that can give back the JSON object a row was read from
+type jsonRecorder interface {
+	JSONRecord(idx int) []byte
+}
+
+// Pop open a dialog with the row dumped as json. Rows read from JSON are
+// shown as they were, unless a column has been changed since.
+func (ui *UI) showRowDetail(rowIdx int) {
+	if source, ok := ui.source.(jsonRecorder); ok && !ui.anyModified() {
+		var pretty bytes.Buffer
+
+		if raw := source.JSONRecord(rowIdx); raw != nil && json.Indent(&pretty, raw, "", "  ") == nil {
+			ui.pushHandler(NewPopup(ui, pretty.String()))
+			return
+		}
+	}
+
+	jsonObj := make(map[string]interface{})
+
+	row := ui.getRow(rowIdx)
+
+	for i, col := range ui.columns {
+		jsonObj[col.Name] = jsonValue(row[i])
+	}
+
+	if jsonStr, err := json.MarshalIndent(jsonObj, "", "  "); err == nil {
+		ui.pushHandler(NewPopup(ui, string(jsonStr)))
+	} else {
+		ui.pushErrorPopup("Failed to dump row as json (this is a bug)", err)
+	}
+}
+
+type HandlerCellSelect struct {
+	HandlerDefault
+}
+
+func NewCellSelect(ui *UI) *HandlerCellSelect {
+	col := ui.columnAt(0)
+	if col < 0 {
+		col = 0
+	}
+
+	ui.cursor = &cellRef{ui.offsetY, col}
+	return &HandlerCellSelect{HandlerDefault{ui}}
+}
+
+func (h *HandlerCellSelect) moveTo(row, col int) {
+	ui := h.ui
+
+	ui.cursor.row = clamp(row, 0, len(ui.filterMatches)-1)
+	ui.cursor.col = clamp(col, 0, len(ui.columns)-1)
+	ui.scrollToCell(ui.cursor.row, ui.cursor.col)
+}
+
+// The value under the cursor, and whether there is one
+func (h *HandlerCellSelect) value() (string, bool) {
+	ui := h.ui
+
+	if ui.cursor.row < 0 || ui.cursor.row >= len(ui.filterMatches) {
+		return "", false
+	}
+
+	row := ui.getRow(ui.filterMatches[ui.cursor.row])
+	return row[ui.cursor.col], true
+}
+
+func (h *HandlerCellSelect) HandleKey(ev termbox.Event) {
+	ui := h.ui
+	cursor := ui.cursor
+	_, vh := ui.viewSize()
+
+	switch {
+	case ev.Key == termbox.KeyEsc, ev.Key == termbox.KeyCtrlG:
+		ui.cursor = nil
+		ui.popHandler()
+	case ev.Key == termbox.KeyArrowUp:
+		h.moveTo(cursor.row-1, cursor.col)
+	case ev.Key == termbox.KeyArrowDown:
+		h.moveTo(cursor.row+1, cursor.col)
+	case ev.Key == termbox.KeyArrowLeft:
+		h.moveTo(cursor.row, ui.findNextColumn(cursor.col, -1))
+	case ev.Key == termbox.KeyArrowRight:
+		h.moveTo(cursor.row, ui.findNextColumn(cursor.col, 1))
+	case ev.Key == termbox.KeyCtrlA:
+		h.moveTo(cursor.row, ui.findFirstColumn())
+	case ev.Key == termbox.KeyCtrlE:
+		h.moveTo(cursor.row, len(ui.columns)-1)
+	case ev.Key == termbox.KeySpace:
+		h.moveTo(cursor.row+vh, cursor.col)
+	case ev.Ch == 'g':
+		h.moveTo(0, cursor.col)
+	case ev.Ch == 'G':
+		h.moveTo(len(ui.filterMatches)-1, cursor.col)
+	case ev.Key == termbox.KeyEnter:
+		if value, ok := h.value(); ok {
+			ui.pushHandler(NewPopup(ui, formatCellDetail(value)))
+		}
+	case ev.Ch == 'o':
+		if _, ok := h.value(); ok {
+			ui.showRowDetail(ui.filterMatches[cursor.row])
+		}
+	case ev.Ch == 'y':
+		if value, ok := h.value(); ok {
+			if value == Null {
+				value = ""
+			}
+
+			if err := copyToClipboard(value); err != nil {
+				ui.pushErrorPopup("Failed to copy to clipboard", err)
+			}
+		}
+	default:
+		if ui.handleColumnKey(cursor.col, ev) {
+			break
+		}
+
+		def := &HandlerDefault{ui}
+		def.HandleKey(ev)
+	}
+}
+
+func (h *HandlerCellSelect) Resize() {
+	h.ui.scrollToCell(h.ui.cursor.row, h.ui.cursor.col)
+}
+
+func (h *HandlerCellSelect) Repaint() {
+	ui := h.ui
+	value, _ := h.value()
+	if value == Null {
+		value = NullText
+	}
+
+	col := fmt.Sprintf("[%s] row %d:", ui.columns[ui.cursor.col].Name, ui.cursor.row)
+	ui.writeModeLine("Cell", []string{col, value})
+}
+
+// Pretty print json values, leave anything else alone
+func formatCellDetail(value string) string {
+	var obj interface{}
+
+	if value == Null {
+		return NullText
+	}
+
+	if err := json.Unmarshal([]byte(value), &obj); err == nil {
+		if pretty, err := json.MarshalIndent(obj, "", "  "); err == nil {
+			return string(pretty)
+		}
+	}
+
+	return value
+}
+
 type HandlerColumnSelect struct {
 	HandlerDefault
 	column int
@@ -330,40 +657,25 @@ func (h *HandlerColumnSelect) selectColumn(idx int) {
 	}
 }
 
-func (h *HandlerColumnSelect) Len() int {
-	return len(h.ui.filterMatches)
-}
-
-func (h *HandlerColumnSelect) Swap(i, j int) {
-	h.ui.filterMatches[i], h.ui.filterMatches[j] = h.ui.filterMatches[j], h.ui.filterMatches[i]
+func (h *HandlerColumnSelect) Resize() {
+	h.ui.scrollToColumn(h.column)
 }
 
-func (h *HandlerColumnSelect) Less(i, j int) bool {
+func (h *HandlerColumnSelect) Repaint() {
 	ui := h.ui
 
-	row1 := ui.getRow(ui.filterMatches[i])
-	row2 := ui.getRow(ui.filterMatches[j])
-
-	v1, err1 := strconv.ParseFloat(row1[h.column], 32)
-	v2, err2 := strconv.ParseFloat(row2[h.column], 32)
+	column := ui.columns[h.column]
+	info := []string{fmt.Sprintf("[%s]", column.Name)}
 
-	if err1 == nil && err2 == nil {
-		return v1 < v2
+	if column.Type != "" {
+		info = append(info, column.Type)
 	}
 
-	return row1[h.column] < row2[h.column]
-}
-
-func (h *HandlerColumnSelect) Repaint() {
-	ui := h.ui
-
-	col := fmt.Sprintf("[%s]", ui.columns[h.column].Name)
-	ui.writeModeLine("Column Select", []string{col})
+	ui.writeModeLine("Column Select", info)
 }
 
 func (h *HandlerColumnSelect) HandleKey(ev termbox.Event) {
 	ui := h.ui
-	col := &ui.columns[h.column]
 
 	switch {
 	case ev.Key == termbox.KeyCtrlA:
@@ -376,20 +688,54 @@ func (h *HandlerColumnSelect) HandleKey(ev termbox.Event) {
 	case ev.Key == termbox.KeyArrowLeft:
 		next := ui.findNextColumn(h.column, -1)
 		h.selectColumn(clamp(next, 0, len(ui.columns)-1))
-	case ev.Ch == '<':
-		sort.Stable(h)
-	case ev.Ch == '>':
-		sort.Stable(sort.Reverse(h))
 	case unicode.ToLower(ev.Ch) == 'c':
 		h.selectColumn(0)
+	case ev.Key == termbox.KeyCtrlG, ev.Key == termbox.KeyEsc:
+		h.selectColumn(-1)
+		ui.popHandler()
+		return
+	default:
+		if ui.handleColumnKey(h.column, ev) {
+			break
+		}
+
+		// FIXME: ditto, is this the best way to do this?
+		def := &HandlerDefault{h.ui}
+		def.HandleKey(ev)
+	}
+
+	// find if we've gone off screen and readjust
+	// TODO: this bit is buggy when scrolling right
+	columnOffset, colWidth := ui.columnOffset(h.column)
+	width, _ := termbox.Size()
+	viewWidth, _ := ui.viewSize()
+
+	if ui.offsetX+width < columnOffset || columnOffset-colWidth < ui.offsetX {
+		ui.offsetX = columnOffset - colWidth
+	}
+
+	lastColumnOffset, _ := ui.columnOffset(len(ui.columns) - 1)
+	ui.offsetX = clamp(ui.offsetX, 0, lastColumnOffset-viewWidth)
+}
+
+// Actions on a single column, shared by the modes that select one.
+// Returns false if the key isn't one of them.
+func (ui *UI) handleColumnKey(colIdx int, ev termbox.Event) bool {
+	col := &ui.columns[colIdx]
+
+	switch {
+	case ev.Ch == '<':
+		ui.sortRows(colIdx, false)
+	case ev.Ch == '>':
+		ui.sortRows(colIdx, true)
 	case ev.Ch == 'w':
 		col.toggleDisplay(ColumnCollapsed)
 	case ev.Ch == 'x':
 		col.toggleDisplay(ColumnExpanded)
-		ui.recomputeColumnWidth(h.column)
+		ui.recomputeColumnWidth(colIdx)
 	case ev.Ch == 'a':
 		col.toggleDisplay(ColumnAligned)
-		ui.recomputeColumnWidth(h.column)
+		ui.recomputeColumnWidth(colIdx)
 	case ev.Ch == '.':
 		col.Pinned = !col.Pinned
 
@@ -397,85 +743,130 @@ func (h *HandlerColumnSelect) HandleKey(ev termbox.Event) {
 			col.Display = ColumnDefault
 		}
 	case ev.Ch == '|':
-		commandStr := ui.columns[h.column].ModifiedCommand
-		h.ui.pushHandler(&HandlerShell{HandlerDefault{ui}, h.column, commandStr})
+		commandStr := ui.columns[colIdx].ModifiedCommand
+		ui.pushHandler(&HandlerShell{HandlerDefault{ui}, colIdx, commandStr})
 	case ev.Ch == 'u':
-		rows := make([]int, 0, len(ui.filterMatches))
-		set := make(map[string]struct{})
+		ui.runTask("Finding unique values", len(ui.filterMatches), func(t *Task) func() {
+			rows := make([]int, 0, len(ui.filterMatches))
+			set := make(map[string]struct{})
+
+			for _, i := range ui.filterMatches {
+				if t.Cancelled() {
+					return nil
+				}
+
+				row := ui.getRow(i)
+				val := row[colIdx]
 
-		for _, i := range ui.filterMatches {
-			row := ui.getRow(i)
-			val := row[h.column]
+				// Take the first row with each value
+				if _, present := set[val]; !present {
+					set[val] = struct{}{}
+					rows = append(rows, i)
+				}
 
-			// Take the first row with each value
-			if _, present := set[val]; !present {
-				set[val] = struct{}{}
-				rows = append(rows, i)
+				t.Step()
 			}
-		}
 
-		ui.filterMatches = rows
+			return func() {
+				ui.stopFeed()
+				ui.filterMatches = rows
+				ui.invalidateSearch()
+
+				// Rows loaded from now on are left out as well
+				ui.uniqueColumn = colIdx
+				ui.uniqueSeen = set
+			}
+		})
 	case ev.Ch == 's':
-		var (
-			min, max, stdev    float64
-			mean, median, mode float64
-			modes              []float64
-			sum, variance      float64
-			p90, p95, p99      float64
-			quartiles          stats.Quartiles
-			err                error
-			text               string
-		)
-
-		colName := ui.columns[h.column].Name
-
-		data := make(stats.Float64Data, 0, len(ui.filterMatches)+1)
-		for _, rowIdx := range ui.filterMatches {
-			row := ui.getRow(rowIdx)
-			trimmed := strings.TrimSpace(row[h.column])
-			if val, err := strconv.ParseFloat(trimmed, 64); err == nil {
-				data = append(data, val)
+		ui.runTask("Summarizing", len(ui.filterMatches), func(t *Task) func() {
+			text, err := ui.summarizeColumn(colIdx, t)
+			if t.Cancelled() {
+				return nil
 			}
-		}
 
-		if len(data) == 0 {
-			data = []float64{0.0, 0.0, 0.0, 0.0}
-		}
+			return func() {
+				if err != nil {
+					ui.pushErrorPopup("Summary stats failed! (probably a bug)", err)
+				} else {
+					ui.pushHandler(NewPopup(ui, text))
+				}
+			}
+		})
+	default:
+		return false
+	}
 
-		// The joy of go
-		if min, err = data.Min(); err != nil {
-			goto error
-		} else if max, err = data.Max(); err != nil {
-			goto error
-		} else if mean, err = data.Mean(); err != nil {
-			goto error
-		} else if median, err = data.Median(); err != nil {
-			goto error
-		} else if modes, err = data.Mode(); err != nil {
-			goto error
-		} else if stdev, err = data.StandardDeviation(); err != nil {
-			goto error
-		} else if sum, err = data.Sum(); err != nil {
-			goto error
-		} else if p90, err = data.Percentile(90); err != nil {
-			goto error
-		} else if p95, err = data.Percentile(95); err != nil {
-			goto error
-		} else if p99, err = data.Percentile(99); err != nil {
-			goto error
-		} else if variance, err = data.Variance(); err != nil {
-			goto error
-		} else if quartiles, err = stats.Quartile(data); err != nil {
-			goto error
+	return true
+}
+
+// Summary statistics for the numeric values of a column
+func (ui *UI) summarizeColumn(colIdx int, t *Task) (string, error) {
+	var (
+		min, max, stdev    float64
+		mean, median, mode float64
+		modes              []float64
+		sum, variance      float64
+		p90, p95, p99      float64
+		quartiles          stats.Quartiles
+		err                error
+		text               string
+	)
+
+	colName := ui.columns[colIdx].Name
+
+	data := make(stats.Float64Data, 0, len(ui.filterMatches)+1)
+	for _, rowIdx := range ui.filterMatches {
+		if t.Cancelled() {
+			return "", nil
 		}
 
-		if len(modes) > 0 {
-			mode = modes[0]
-		} else {
-			mode = math.NaN()
+		row := ui.getRow(rowIdx)
+		trimmed := strings.TrimSpace(row[colIdx])
+		if val, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			data = append(data, val)
 		}
 
-		text = fmt.Sprintf(`
+		t.Step()
+	}
+
+	if len(data) == 0 {
+		data = []float64{0.0, 0.0, 0.0, 0.0}
+	}
+
+	// The joy of go
+	if min, err = data.Min(); err != nil {
+		goto error
+	} else if max, err = data.Max(); err != nil {
+		goto error
+	} else if mean, err = data.Mean(); err != nil {
+		goto error
+	} else if median, err = data.Median(); err != nil {
+		goto error
+	} else if modes, err = data.Mode(); err != nil {
+		goto error
+	} else if stdev, err = data.StandardDeviation(); err != nil {
+		goto error
+	} else if sum, err = data.Sum(); err != nil {
+		goto error
+	} else if p90, err = data.Percentile(90); err != nil {
+		goto error
+	} else if p95, err = data.Percentile(95); err != nil {
+		goto error
+	} else if p99, err = data.Percentile(99); err != nil {
+		goto error
+	} else if variance, err = data.Variance(); err != nil {
+		goto error
+	} else if quartiles, err = stats.Quartile(data); err != nil {
+		goto error
+	}
+
+	if len(modes) > 0 {
+		mode = modes[0]
+	} else {
+		mode = math.NaN()
+	}
+
+	text = fmt.Sprintf(`
   [ %s ]
   %s
   rows visible: %d (of %d)
@@ -490,38 +881,55 @@ func (h *HandlerColumnSelect) HandleKey(ev termbox.Event) {
   p90: %15.4f      p25:    %15.4f
   p95: %15.4f      p50:    %15.4f
   p99: %15.4f      p75:    %15.4f`,
-			colName, strings.Repeat("-", 4+len(colName)),
-			len(ui.filterMatches), len(ui.rows), len(data),
-			min, mean, max, median, sum, mode, variance, stdev,
-			p90, quartiles.Q1, p95, quartiles.Q2, p99, quartiles.Q3)
+		colName, strings.Repeat("-", 4+displayWidth(colName)),
+		len(ui.filterMatches), ui.loaded, len(data),
+		min, mean, max, median, sum, mode, variance, stdev,
+		p90, quartiles.Q1, p95, quartiles.Q2, p99, quartiles.Q3)
 
-		ui.pushHandler(NewPopup(ui, text))
+	return text, nil
 
-		break
-	error:
-		ui.pushErrorPopup("Summary stats failed! (probably a bug)", err)
-	case ev.Key == termbox.KeyCtrlG, ev.Key == termbox.KeyEsc:
-		h.selectColumn(-1)
-		ui.popHandler()
+error:
+	return "", err
+}
+
+// Shown while a background task runs, everything but cancelling waits
+// for it to finish.
+type HandlerTask struct {
+	HandlerDefault
+	task *Task
+}
+
+func (h *HandlerTask) HandleKey(ev termbox.Event) {
+	if ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlG {
+		h.task.Cancel()
+	}
+}
+
+// Called from the event loop whenever it's woken up
+func (h *HandlerTask) poll() {
+	if !h.task.finished.Load() {
 		return
-	default:
-		// FIXME: ditto, is this the best way to do this?
-		def := &HandlerDefault{h.ui}
-		def.HandleKey(ev)
 	}
 
-	// find if we've gone off screen and readjust
-	// TODO: this bit is buggy when scrolling right
-	columnOffset, colWidth := ui.columnOffset(h.column)
-	width, _ := termbox.Size()
-	viewWidth, _ := ui.viewSize()
+	h.ui.popHandler()
 
-	if ui.offsetX+width < columnOffset || columnOffset-colWidth < ui.offsetX {
-		ui.offsetX = columnOffset - colWidth
+	if !h.task.Cancelled() && h.task.apply != nil {
+		h.task.apply()
 	}
 
-	lastColumnOffset, _ := ui.columnOffset(len(ui.columns) - 1)
-	ui.offsetX = clamp(ui.offsetX, 0, lastColumnOffset-viewWidth)
+	h.ui.syncSource()
+}
+
+func (h *HandlerTask) Repaint() {
+	status := "working..."
+
+	if h.task.Cancelled() {
+		status = "cancelling..."
+	} else if pct := h.task.Percent(); pct >= 0 {
+		status = fmt.Sprintf("%d%%", pct)
+	}
+
+	h.ui.writeModeLine(h.task.Name, []string{status, "(Ctrl g to cancel)"})
 }
 
 type HandlerPopup struct {
@@ -544,6 +952,10 @@ func (h *HandlerPopup) size() (int, int) {
 	popupW := clamp(120, 50, width-15)
 	popupH := clamp(len(h.content), 10, height-5)
 
+	// Shrink to fit tiny terminals, leaving room for the borders
+	popupW = clamp(popupW, 1, width-4)
+	popupH = clamp(popupH, 1, height-3)
+
 	return popupW, popupH
 }
 
@@ -570,18 +982,8 @@ func (h *HandlerPopup) Repaint() {
 		} else if i < popupH {
 			border = borders[1]
 			if i+h.offsetY < len(h.content) {
-				content = h.content[i+h.offsetY]
-
 				// Horizontal scrolling
-				if h.offsetX > len(content) {
-					content = ""
-				} else {
-					content = content[h.offsetX:]
-				}
-
-				if len(content) >= popupW {
-					content = content[0:popupW]
-				}
+				content = sliceCells(h.content[i+h.offsetY], h.offsetX, popupW)
 			} else {
 				content = " "
 			}
@@ -590,22 +992,96 @@ func (h *HandlerPopup) Repaint() {
 			content = strings.Repeat("─", popupW)
 		}
 
-		line := fmt.Sprintf("%s%-*s%s", border[0], popupW, content, border[1])
+		line := border[0] + padRight(content, popupW) + border[1]
 		writeString(x, y+i, termbox.ColorDefault, termbox.ColorDefault, line)
 	}
 
 	h.ui.writeModeLine("Modal", []string{})
 }
 
+func (h *HandlerPopup) maxScroll() int {
+	_, maxScroll := h.size()
+	if maxScroll >= len(h.content) {
+		maxScroll = 0
+	}
+
+	return maxScroll
+}
+
+// The popup is drawn centered on each repaint, but may now be scrolled
+// further than it can go.
+func (h *HandlerPopup) Resize() {
+	h.offsetY = clamp(h.offsetY, 0, h.maxScroll())
+}
+
+// A popup listing items to pick from, [ENTER] calls choose with the index
+// of the selected one, e.g. problems found while reading the input.
+type HandlerList struct {
+	HandlerPopup
+
+	mode     string
+	hint     string
+	items    []string
+	selected int
+	choose   func(idx int)
+}
+
+func NewListPopup(ui *UI, mode, hint string, items []string, choose func(idx int)) *HandlerList {
+	return &HandlerList{
+		HandlerPopup: *NewPopup(ui, ""),
+		mode:         mode,
+		hint:         hint,
+		items:        items,
+		choose:       choose,
+	}
+}
+
+func (h *HandlerList) Repaint() {
+	h.content = make([]string, len(h.items))
+
+	for i, item := range h.items {
+		marker := "  "
+		if i == h.selected {
+			marker = "» "
+		}
+
+		h.content[i] = marker + item
+	}
+
+	// Keep the selection in view
+	_, popupH := h.size()
+	if h.selected < h.offsetY {
+		h.offsetY = h.selected
+	} else if h.selected >= h.offsetY+popupH {
+		h.offsetY = h.selected - popupH + 1
+	}
+
+	h.HandlerPopup.Repaint()
+
+	status := fmt.Sprintf("%d of %d", h.selected+1, len(h.items))
+	h.ui.writeModeLine(h.mode, []string{status, h.hint})
+}
+
+func (h *HandlerList) HandleKey(ev termbox.Event) {
+	switch ev.Key {
+	case termbox.KeyArrowUp:
+		h.selected = clamp(h.selected-1, 0, len(h.items)-1)
+	case termbox.KeyArrowDown:
+		h.selected = clamp(h.selected+1, 0, len(h.items)-1)
+	case termbox.KeyEnter:
+		h.ui.popHandler()
+		h.choose(h.selected)
+	default:
+		h.HandlerPopup.HandleKey(ev)
+	}
+}
+
 func (h *HandlerPopup) HandleKey(ev termbox.Event) {
 	if ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlG || ev.Ch == 'q' {
 		h.ui.popHandler()
 	}
 
-	_, maxScroll := h.size()
-	if maxScroll >= len(h.content) {
-		maxScroll = 0
-	}
+	maxScroll := h.maxScroll()
 
 	switch ev.Key {
 	case termbox.KeyArrowLeft:
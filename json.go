@@ -0,0 +1,243 @@
+// Reading JSON Lines and JSON arrays of objects.
+
+package vxsv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// A flattened key of an object, e.g. "req.headers.host"
+type jsonField struct {
+	key, value string
+}
+
+type jsonRecords struct {
+	source *StreamSource
+	dec    *json.Decoder
+	array  bool  // Records are elements of a single top level array
+	skip   int64 // Whitespace skipped before the decoder started
+	last   json.RawMessage
+
+	mu    sync.RWMutex
+	index map[string]int // Column of each key seen so far
+}
+
+func (r *jsonRecords) Read() ([]string, int64, error) {
+	if r.array && !r.dec.More() {
+		return nil, 0, io.EOF
+	}
+
+	var raw json.RawMessage
+	if err := r.dec.Decode(&raw); err != nil {
+		return nil, 0, err
+	}
+
+	record, err := r.parse(raw, true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r.last = raw
+	return record, r.skip + r.dec.InputOffset(), nil
+}
+
+func (r *jsonRecords) lastRaw() []byte {
+	return r.last
+}
+
+// Flatten an object into a row. Keys not seen before become new columns
+// when grow is set, and are skipped otherwise.
+func (r *jsonRecords) parse(raw []byte, grow bool) ([]string, error) {
+	fields := []jsonField{}
+	if err := flattenJSON("", trimJSONRecord(raw), &fields); err != nil {
+		return nil, err
+	}
+
+	if grow {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+	} else {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+	}
+
+	row := make([]string, len(r.index))
+
+	for _, field := range fields {
+		idx, ok := r.index[field.key]
+		if !ok && !grow {
+			continue
+		} else if !ok {
+			idx = r.source.addColumn(field.key)
+			r.index[field.key] = idx
+			row = append(row, "")
+		}
+
+		row[idx] = field.value
+	}
+
+	return row, nil
+}
+
+// Records are re-read along with anything between them and the previous
+// one, i.e. the comma between the elements of an array.
+func trimJSONRecord(raw []byte) []byte {
+	return bytes.TrimLeft(raw, " \t\r\n,")
+}
+
+// Add the fields of a value to fields, with nested objects flattened out
+// into dotted names. Anything other than an object ends up in a single
+// field, arrays as compact JSON.
+func flattenJSON(prefix string, raw []byte, fields *[]jsonField) error {
+	raw = bytes.TrimSpace(raw)
+
+	if len(raw) == 0 || raw[0] != '{' {
+		if prefix == "" {
+			prefix = "value"
+		}
+
+		text, err := jsonText(raw)
+		if err != nil {
+			return err
+		}
+
+		*fields = append(*fields, jsonField{prefix, text})
+		return nil
+	}
+
+	// Decoding token by token keeps the keys in order
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	empty := true
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+
+		key, _ := tok.(string)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if err := flattenJSON(key, value, fields); err != nil {
+			return err
+		}
+
+		empty = false
+	}
+
+	if empty && prefix != "" {
+		*fields = append(*fields, jsonField{prefix, "{}"})
+	}
+
+	return nil
+}
+
+// The text shown for a value: strings without quotes, numbers as they
+// were written and null as Null.
+func jsonText(raw []byte) (string, error) {
+	switch {
+	case string(raw) == "null":
+		return Null, nil
+	case len(raw) > 0 && raw[0] == '"':
+		var str string
+		err := json.Unmarshal(raw, &str)
+		return escapeNul(str), err
+	case len(raw) > 0 && raw[0] == '[':
+		var buf bytes.Buffer
+		err := json.Compact(&buf, raw)
+		return buf.String(), err
+	}
+
+	return string(raw), nil
+}
+
+// Rows read from JSON can be shown as the objects they came from.
+type jsonSource struct {
+	*StreamSource
+}
+
+func (s jsonSource) JSONRecord(idx int) []byte {
+	if raw := s.raw(idx); raw != nil {
+		return trimJSONRecord(raw)
+	}
+
+	return nil
+}
+
+// Reads either JSON Lines (one object per line) or a JSON array of
+// objects. Columns are the union of the keys of every object, in the
+// order they were first seen, with nested objects flattened out:
+//
+//	{"id": 1, "req": {"method": "GET", "headers": {"host": "a.com"}}}
+//
+// has the columns id, req.method and req.headers.host. The first record
+// is read immediately to find some columns to start with, the remaining
+// ones in the background.
+func ReadJSONFile(reader io.Reader, count int64) (RowSource, error) {
+	records := &jsonRecords{index: make(map[string]int)}
+
+	source := newStreamSource(reader, func(buf []byte) ([]string, error) {
+		return records.parse(buf, false)
+	})
+	records.source = source
+
+	buffered := bufio.NewReader(reader)
+
+	// Skip to the first value to see if it's an array
+	for {
+		ch, err := buffered.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if ch != ' ' && ch != '\t' && ch != '\r' && ch != '\n' {
+			buffered.UnreadByte()
+			records.array = ch == '['
+			break
+		}
+
+		records.skip++
+	}
+
+	records.dec = json.NewDecoder(buffered)
+
+	if records.array {
+		if _, err := records.dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	source.begin([]Column{}, records.skip+records.dec.InputOffset())
+
+	record, end, err := records.Read()
+	if err == io.EOF {
+		return nil, errors.New("No records found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if count > 0 {
+		source.add(record, end)
+		source.addRaw(records.lastRaw())
+	}
+
+	go source.load(records, count)
+
+	return jsonSource{source}, nil
+}
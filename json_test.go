@@ -0,0 +1,74 @@
+package vxsv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadJSONFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  readTable
+	}{
+		{
+			"json lines",
+			"{\"id\": 1, \"name\": \"foo\"}\n{\"id\": 2, \"name\": \"bar\"}\n",
+			readTable{[]string{"id", "name"}, [][]string{{"1", "foo"}, {"2", "bar"}}},
+		},
+		{
+			"array",
+			"  [\n  {\"id\": 1},\n  {\"id\": 2}\n]\n",
+			readTable{[]string{"id"}, [][]string{{"1"}, {"2"}}},
+		},
+		{
+			"nested objects",
+			`{"id": 1, "req": {"method": "GET", "headers": {"host": "a.com"}}, "meta": {}}`,
+			readTable{[]string{"id", "req.method", "req.headers.host", "meta"}, [][]string{{"1", "GET", "a.com", "{}"}}},
+		},
+		{
+			"keys found later",
+			"{\"a\": 1}\n{\"b\": 2, \"a\": 3}\n",
+			readTable{[]string{"a", "b"}, [][]string{{"1", ""}, {"3", "2"}}},
+		},
+		{
+			"values as written",
+			`{"n": 1.50, "big": 12345678901234567890, "ok": true, "list": [1, "x", null], "s": "007"}`,
+			readTable{[]string{"n", "big", "ok", "list", "s"}, [][]string{{"1.50", "12345678901234567890", "true", `[1,"x",null]`, "007"}}},
+		},
+		{
+			"null and NUL",
+			`{"a": null, "b": "x\u0000y", "c": ""}`,
+			readTable{[]string{"a", "b", "c"}, [][]string{{Null, "x␀y", ""}}},
+		},
+		{
+			"values other than objects",
+			"1\n\"two\"\n",
+			readTable{[]string{"value"}, [][]string{{"1"}, {"two"}}},
+		},
+	}
+
+	for _, test := range tests {
+		for kind, input := range pipeAndFile(t, test.input) {
+			source, err := ReadJSONFile(input(), 100)
+			if err != nil {
+				t.Errorf("%s from a %s: %v", test.name, kind, err)
+				continue
+			}
+
+			names, rows := readSource(t, source)
+			if got := (readTable{names, rows}); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s from a %s: read %q, want %q", test.name, kind, got, test.want)
+			}
+		}
+	}
+}
+
+func TestReadJSONFileErrors(t *testing.T) {
+	for _, input := range []string{"", "[]", "{\"a\": "} {
+		if _, err := ReadJSONFile(strings.NewReader(input), 100); err == nil {
+			t.Errorf("ReadJSONFile(%q) succeeded, want an error", input)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Mouse input, handled the same way in every mode that shows the table.
+
+package vxsv
+
+import (
+	"github.com/nsf/termbox-go"
+)
+
+// Rows scrolled per turn of the mouse wheel
+const WheelScrollRows = 3
+
+func (ui *UI) handleMouse(ev termbox.Event) {
+	switch ui.activeHandler().(type) {
+	case *HandlerDefault, *HandlerCellSelect, *HandlerColumnSelect, *HandlerRowSelect:
+	default:
+		// Prompts, popups and the like only use the keyboard
+		return
+	}
+
+	switch {
+	case ev.Key == termbox.MouseWheelUp:
+		ui.offsetY = clamp(ui.offsetY-WheelScrollRows, 0, ui.maxOffsetY())
+	case ev.Key == termbox.MouseWheelDown:
+		ui.offsetY = clamp(ui.offsetY+WheelScrollRows, 0, ui.maxOffsetY())
+	case ev.Key == termbox.MouseRelease:
+		ui.dragColumn = -1
+	case ev.Key == termbox.MouseLeft && ev.Mod&termbox.ModMotion != 0:
+		if ui.dragColumn >= 0 {
+			width := ui.dragWidth + ev.MouseX - ui.dragX
+
+			col := &ui.columns[ui.dragColumn]
+			col.Display = ColumnResized
+			col.ResizedWidth = clamp(width, 1, width)
+		}
+	case ev.Key == termbox.MouseLeft:
+		ui.handleClick(ev.MouseX, ev.MouseY)
+	}
+}
+
+func (ui *UI) handleClick(x, y int) {
+	colIdx, onSeparator := ui.hitColumn(x)
+	if colIdx < 0 {
+		return
+	}
+
+	if onSeparator {
+		ui.dragColumn = colIdx
+		ui.dragX = x
+		ui.dragWidth = ui.columns[colIdx].displayWidth()
+		return
+	}
+
+	// Clicking a header sorts, the second click reverses the order
+	if y == 0 {
+		ui.sortRows(colIdx, ui.sortColumn == colIdx && !ui.sortReverse)
+		return
+	}
+
+	_, vh := ui.viewSize()
+	row := ui.offsetY + y - 1
+
+	if y > vh || row >= len(ui.filterMatches) {
+		return
+	}
+
+	switch h := ui.activeHandler().(type) {
+	case *HandlerCellSelect:
+		h.moveTo(row, colIdx)
+	case *HandlerColumnSelect:
+		h.selectColumn(colIdx)
+	case *HandlerRowSelect:
+		h.rowIdx = row
+	default:
+		cellSelect := NewCellSelect(ui)
+		ui.pushHandler(cellSelect)
+		cellSelect.moveTo(row, colIdx)
+	}
+}
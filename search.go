@@ -0,0 +1,140 @@
+// Searching for cells without hiding any rows.
+
+package vxsv
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A cell of the displayed rows, row being an index into filterMatches
+type cellRef struct {
+	row, col int
+}
+
+type Search struct {
+	text  string
+	regex *regexp.Regexp
+
+	// Found matches in display order, nil when the rows have changed
+	// since the last time we looked.
+	matches []cellRef
+	current int
+}
+
+// Searches are case insensitive, unless written as /pattern/flags. Text
+// without the closing slash is searched for as it is.
+func NewSearch(text string) (*Search, error) {
+	if strings.HasPrefix(text, "/") && strings.LastIndex(text, "/") > 0 {
+		regex, err := compileFilterRegex(text)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Search{text: text, regex: regex}, nil
+	}
+
+	regex := regexp.MustCompile("(?i)" + regexp.QuoteMeta(text))
+	return &Search{text: text, regex: regex}, nil
+}
+
+// NULL cells never match, as with filters
+func (s *Search) Matches(cell string) bool {
+	if cell == Null {
+		return false
+	}
+
+	return s.regex.MatchString(cell)
+}
+
+func (s *Search) isCurrent(row, col int) bool {
+	if s.current < 0 || s.current >= len(s.matches) {
+		return false
+	}
+
+	current := s.matches[s.current]
+	return current.row == row && current.col == col
+}
+
+// Shown in the mode line
+func (s *Search) Status() string {
+	if s.matches == nil {
+		return ""
+	} else if len(s.matches) == 0 {
+		return "no matches"
+	}
+
+	return fmt.Sprintf("match %d of %d", s.current+1, len(s.matches))
+}
+
+// Forget found matches, e.g. when rows are filtered or sorted
+func (ui *UI) invalidateSearch() {
+	if ui.search != nil {
+		ui.search.matches = nil
+	}
+}
+
+// Find every matching cell in the background, then jump to the match
+// nearest the top of the screen in the given direction.
+func (ui *UI) runSearch(search *Search, direction int) {
+	ui.runTask("Searching", len(ui.filterMatches), func(t *Task) func() {
+		matches := []cellRef{}
+
+		for pos, idx := range ui.filterMatches {
+			if t.Cancelled() {
+				return nil
+			}
+
+			for col, cell := range ui.getRow(idx) {
+				if search.Matches(cell) {
+					matches = append(matches, cellRef{pos, col})
+				}
+			}
+
+			t.Step()
+		}
+
+		return func() {
+			search.matches = matches
+			search.current = -1
+			ui.search = search
+
+			ui.nextMatch(direction)
+		}
+	})
+}
+
+// Jump to the next (1) or previous (-1) match, wrapping around the ends
+func (ui *UI) nextMatch(direction int) {
+	search := ui.search
+	if search == nil {
+		return
+	} else if search.matches == nil {
+		ui.runSearch(search, direction)
+		return
+	} else if len(search.matches) == 0 {
+		return
+	}
+
+	if search.current < 0 {
+		// Start from the first match on screen
+		search.current = len(search.matches) - 1
+		for i, match := range search.matches {
+			if match.row >= ui.offsetY {
+				search.current = i - 1
+				break
+			}
+		}
+
+		if direction < 0 {
+			search.current++
+		}
+	}
+
+	count := len(search.matches)
+	search.current = (search.current + direction + count) % count
+
+	match := search.matches[search.current]
+	ui.scrollToCell(match.row, match.col)
+}
@@ -0,0 +1,45 @@
+package vxsv
+
+import "testing"
+
+func TestSearchMatches(t *testing.T) {
+	tests := []struct {
+		text  string
+		cell  string
+		match bool
+	}{
+		{"foo", "a FOO b", true},
+		{"foo", "fo", false},
+		{"a.b", "axb", false},
+		{"a.b", "A.B", true},
+		{"/foo", "x /FOO", true},
+		{"/foo", "foo", false},
+		{"/", "a/b", true},
+		{"/^f.o$/", "foo", true},
+		{"/^f.o$/", "FOO", false},
+		{"/^f.o$/i", "FOO", true},
+		{"", Null, false},
+		{"/.*/", Null, false},
+		{"", "", true},
+	}
+
+	for _, test := range tests {
+		search, err := NewSearch(test.text)
+		if err != nil {
+			t.Errorf("NewSearch(%q): %v", test.text, err)
+			continue
+		}
+
+		if got := search.Matches(test.cell); got != test.match {
+			t.Errorf("NewSearch(%q).Matches(%q) = %v, want %v", test.text, test.cell, got, test.match)
+		}
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	for _, text := range []string{"/(/", "/a/x"} {
+		if _, err := NewSearch(text); err == nil {
+			t.Errorf("NewSearch(%q) succeeded, want an error", text)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+// Guessing the format of the input from the first few kilobytes.
+
+package vxsv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type InputFormat int
+
+const (
+	InputCSV = iota
+	InputPSQL
+	InputMySQL
+	InputJSON
+	InputFixed
+	InputSpreadsheet
+	InputSQLite
+)
+
+// How much of the input is looked at
+const sniffLength = 16 * 1024
+
+// What the input looks like, either guessed by Sniff or given on the
+// command line.
+type Sniffed struct {
+	Format    InputFormat
+	Delimiter rune // Only for InputCSV
+	Header    bool // Not for psql, mysql, JSON or SQLite
+}
+
+// Short description for the mode line, e.g. "csv (;)"
+func (s Sniffed) String() string {
+	switch s.Format {
+	case InputPSQL:
+		return "psql"
+	case InputMySQL:
+		return "mysql"
+	case InputJSON:
+		return "json"
+	case InputSpreadsheet:
+		return "spreadsheet"
+	case InputSQLite:
+		return "sqlite"
+	}
+
+	desc := "csv"
+
+	switch {
+	case s.Format == InputFixed:
+		desc = "fixed width"
+	case s.Delimiter == ',':
+	case s.Delimiter == '\t':
+		desc = "tsv"
+	default:
+		desc = fmt.Sprintf("csv (%c)", s.Delimiter)
+	}
+
+	if !s.Header {
+		desc += ", no header"
+	}
+
+	return desc
+}
+
+// Look at the first n bytes of the input without consuming them. Returns
+// the reader to use from then on, which is the file itself for anything
+// that can be rewound.
+//
+// Pipes may be slow to fill up, or never end (tail -f, kubectl get -w),
+// so only what arrives within a moment of the first read is looked at.
+func peekInput(input io.Reader, n int) (io.Reader, []byte, error) {
+	if file, ok := input.(*os.File); ok {
+		if pos, err := file.Seek(0, io.SeekCurrent); err == nil {
+			buf := make([]byte, n)
+			read, _ := io.ReadFull(file, buf)
+
+			if _, err := file.Seek(pos, io.SeekStart); err != nil {
+				return nil, nil, err
+			}
+
+			return file, buf[:read], nil
+		}
+	}
+
+	peeker, ok := input.(*peekReader)
+	if !ok {
+		peeker = newPeekReader(input)
+	}
+
+	return peeker, peeker.peek(n, peekWait), nil
+}
+
+// How long to wait for more of a pipe to arrive, see peekInput
+const peekWait = 100 * time.Millisecond
+
+// peekReader reads a pipe in a goroutine, so that peeking at it can stop
+// waiting for more.
+type peekReader struct {
+	chunks  chan []byte
+	err     error // Set once chunks is closed
+	eof     bool  // Whether chunks has been seen closed
+	pending []byte
+}
+
+func newPeekReader(input io.Reader) *peekReader {
+	r := &peekReader{chunks: make(chan []byte)}
+
+	go func() {
+		for {
+			buf := make([]byte, 32*1024)
+			n, err := input.Read(buf)
+
+			if n > 0 {
+				r.chunks <- buf[:n]
+			}
+
+			if err != nil {
+				r.err = err
+				close(r.chunks)
+				return
+			}
+		}
+	}()
+
+	return r
+}
+
+// Wait for the next chunk of input, or until timeout (which can be nil).
+// Returns false if nothing more was read.
+func (r *peekReader) fill(timeout <-chan time.Time) bool {
+	select {
+	case chunk, ok := <-r.chunks:
+		if !ok {
+			r.eof = true
+			return false
+		}
+
+		r.pending = append(r.pending, chunk...)
+		return true
+	case <-timeout:
+		return false
+	}
+}
+
+// Up to n bytes, waiting for the first of them and then at most wait for
+// the rest.
+func (r *peekReader) peek(n int, wait time.Duration) []byte {
+	if len(r.pending) == 0 {
+		r.fill(nil)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for len(r.pending) < n && r.fill(timer.C) {
+	}
+
+	if len(r.pending) < n {
+		return r.pending
+	}
+
+	return r.pending[:n]
+}
+
+func (r *peekReader) discard(n int) {
+	r.pending = r.pending[n:]
+}
+
+func (r *peekReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 && !r.fill(nil) {
+		return 0, r.err
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+
+	return n, nil
+}
+
+// Guess the format of the input. Given a delimiter, the input is taken to
+// be CSV and only the header is guessed.
+func Sniff(input io.Reader, delimiter rune) (io.Reader, Sniffed, error) {
+	reader, sample, err := peekInput(input, sniffLength)
+	if err != nil {
+		return nil, Sniffed{}, err
+	}
+
+	// Don't look at a line that was cut off part way
+	partial := len(sample) == sniffLength
+	if peeker, ok := reader.(*peekReader); ok && !peeker.eof {
+		partial = true
+	}
+
+	if partial {
+		if end := bytes.LastIndexByte(sample, '\n'); end > 0 {
+			sample = sample[:end+1]
+		}
+	}
+
+	if delimiter == 0 {
+		if bytes.HasPrefix(sample, zipMagic) {
+			return reader, Sniffed{Format: InputSpreadsheet, Header: true}, nil
+		} else if bytes.HasPrefix(sample, sqliteMagic) {
+			return reader, Sniffed{Format: InputSQLite}, nil
+		}
+
+		if format, ok := sniffTableFormat(sample); ok {
+			return reader, Sniffed{Format: format}, nil
+		}
+
+		var found bool
+		if delimiter, found = sniffDelimiter(sample); !found {
+			// Command output like this practically always has a header
+			if isFixedWidth(sample) {
+				return reader, Sniffed{Format: InputFixed, Header: true}, nil
+			}
+		}
+	}
+
+	return reader, Sniffed{
+		Format:    InputCSV,
+		Delimiter: delimiter,
+		Header:    sniffHeader(sampleRecords(sample, delimiter)),
+	}, nil
+}
+
+// Recognize the output of psql and mysql, or JSON.
+func sniffTableFormat(sample []byte) (InputFormat, bool) {
+	text := bytes.TrimLeft(sample, " \t\r\n")
+
+	if len(text) > 0 && text[0] == '{' {
+		return InputJSON, true
+	} else if len(text) > 0 && text[0] == '[' {
+		// Only an array of objects, "[1]" could just as well be a CSV header
+		if next := bytes.TrimLeft(text[1:], " \t\r\n"); len(next) > 0 && (next[0] == '{' || next[0] == ']') {
+			return InputJSON, true
+		}
+	}
+
+	lines := strings.Split(string(sample), "\n")
+
+	// psql prints messages such as "SET" before any tables, so look a
+	// little further than the first line
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+
+		switch {
+		case i >= 20:
+			return InputCSV, false
+		case isVerticalHeader(line):
+			return InputMySQL, true
+		case isExpandedHeader(line):
+			return InputPSQL, true
+		case !isSeparatorLine(line):
+			continue
+		case strings.HasPrefix(strings.TrimSpace(ruleReplacer.Replace(line)), "+"):
+			return boxedTableFormat(line, lines), true
+		case i > 0 && strings.TrimSpace(lines[i-1]) != "":
+			// A header with a separator line below it
+			return InputPSQL, true
+		}
+	}
+
+	return InputCSV, false
+}
+
+// Boxed tables look the same from psql with "\pset border 2" as from
+// mysql, so go by the footer, or the box drawing characters that only
+// psql uses.
+func boxedTableFormat(border string, lines []string) InputFormat {
+	if ruleReplacer.Replace(border) != border {
+		return InputPSQL
+	}
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if strings.Contains(line, " in set") || strings.HasPrefix(line, "Empty set") {
+			return InputMySQL
+		} else if isRowCount(line) {
+			return InputPSQL
+		}
+	}
+
+	return InputMySQL
+}
+
+// Candidates, in order of preference when they fit equally well
+var sniffDelimiters = []rune{',', '\t', ';', '|'}
+
+// Pick the delimiter that splits the sample into the most consistent
+// number of fields, preferring more fields when that's a tie. Not found
+// if none of them split anything.
+func sniffDelimiter(sample []byte) (rune, bool) {
+	best := ','
+	bestConsistency, bestFields := 0.0, 1
+
+	for _, delimiter := range sniffDelimiters {
+		records := sampleRecords(sample, delimiter)
+		if len(records) == 0 || len(records[0]) < 2 {
+			continue
+		}
+
+		fields := len(records[0])
+		matching := 0
+
+		for _, record := range records {
+			if len(record) == fields {
+				matching++
+			}
+		}
+
+		consistency := float64(matching) / float64(len(records))
+
+		if consistency > bestConsistency || (consistency == bestConsistency && fields > bestFields) {
+			best = delimiter
+			bestConsistency, bestFields = consistency, fields
+		}
+	}
+
+	return best, bestConsistency > 0
+}
+
+// Whether the sample is lined up in columns with spaces
+func isFixedWidth(sample []byte) bool {
+	lines := []string{}
+	for _, line := range strings.Split(string(sample), "\n") {
+		if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return len(lines) > 1 && len(inferColumnStarts(lines, true)) > 1
+}
+
+// Parse as much of the sample as possible, skipping over anything
+// malformed.
+func sampleRecords(sample []byte, delimiter rune) [][]string {
+	reader := csv.NewReader(bytes.NewReader(sample))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records := [][]string{}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// Like Python's csv.Sniffer, each column where the rows below the first
+// share a type (numeric, or a fixed length) votes on whether the first
+// row looks out of place. With no evidence either way, assume a header.
+func sniffHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return true
+	}
+
+	first, rows := records[0], records[1:]
+	votes := 0
+
+	for i, name := range first {
+		numeric, length, seen := true, -1, 0
+
+		for _, row := range rows {
+			if i >= len(row) || row[i] == "" {
+				continue
+			}
+
+			seen++
+
+			if _, err := strconv.ParseFloat(row[i], 64); err != nil {
+				numeric = false
+			}
+
+			if length == -1 {
+				length = len(row[i])
+			} else if length != len(row[i]) {
+				length = -2
+			}
+		}
+
+		if seen == 0 {
+			continue
+		}
+
+		_, err := strconv.ParseFloat(name, 64)
+
+		switch {
+		case numeric && err != nil:
+			votes++
+		case numeric:
+			votes--
+		case length >= 0 && len(name) != length:
+			votes++
+		case length >= 0:
+			votes--
+		}
+	}
+
+	return votes >= 0
+}
@@ -0,0 +1,102 @@
+package vxsv
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Sniffed
+	}{
+		{"csv", "name,age\nalice,30\nbob,41\n", Sniffed{Format: InputCSV, Delimiter: ',', Header: true}},
+		{"csv without header", "alice,30\nbob,41\ncarol,52\n", Sniffed{Format: InputCSV, Delimiter: ',', Header: false}},
+		{"tsv", "a\tb\tc\n1\t2\t3\n", Sniffed{Format: InputCSV, Delimiter: '\t', Header: true}},
+		{"semicolons", "a;b\n1,5;2,5\n3,5;4,5\n", Sniffed{Format: InputCSV, Delimiter: ';', Header: true}},
+		{"psql", " id | name\n----+------\n  1 | foo\n(1 row)\n", Sniffed{Format: InputPSQL}},
+		{"psql after messages", "SET\n id | name\n----+------\n  1 | foo\n", Sniffed{Format: InputPSQL}},
+		{"psql unicode", " id │ name\n────┼──────\n  1 │ foo\n", Sniffed{Format: InputPSQL}},
+		{"psql expanded", "-[ RECORD 1 ]\nid   | 1\nname | foo\n", Sniffed{Format: InputPSQL}},
+		{"mysql", "+----+------+\n| id | name |\n+----+------+\n|  1 | foo  |\n+----+------+\n1 row in set (0.00 sec)\n", Sniffed{Format: InputMySQL}},
+		{"mysql vertical", "*************************** 1. row ***************************\n  id: 1\nname: foo\n", Sniffed{Format: InputMySQL}},
+		{"psql boxed", "+----+------+\n| id | name |\n+----+------+\n|  1 | foo  |\n+----+------+\n(1 row)\n", Sniffed{Format: InputPSQL}},
+		{"json", "  {\"a\": 1}\n", Sniffed{Format: InputJSON}},
+		{"json array", "[{\"a\": 1}]", Sniffed{Format: InputJSON}},
+		{"csv header like an array", "[1],[2]\n3,4\n", Sniffed{Format: InputCSV, Delimiter: ',', Header: true}},
+		{"fixed width", "NAME      READY   STATUS\nweb-1     1/1     Running\ndb-0      0/1     Pending\n", Sniffed{Format: InputFixed, Header: true}},
+		{"spreadsheet", "PK\x03\x04rest", Sniffed{Format: InputSpreadsheet, Header: true}},
+		{"sqlite", "SQLite format 3\x00rest", Sniffed{Format: InputSQLite}},
+	}
+
+	for _, test := range tests {
+		reader, got, err := Sniff(strings.NewReader(test.input), 0)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: Sniff() = %+v, want %+v", test.name, got, test.want)
+		}
+
+		// Nothing is consumed
+		if rest, _ := io.ReadAll(reader); string(rest) != test.input {
+			t.Errorf("%s: reader returned %q, want %q", test.name, rest, test.input)
+		}
+	}
+}
+
+func TestSniffGivenDelimiter(t *testing.T) {
+	_, got, err := Sniff(strings.NewReader(" id | name\n----+------\n"), '|')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Format != InputCSV || got.Delimiter != '|' {
+		t.Errorf("Sniff() = %+v, want csv with delimiter |", got)
+	}
+}
+
+// A pipe that never ends is sniffed on what has arrived so far
+func TestSniffOpenPipe(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	go pw.Write([]byte("a,b\n1,2\n3,"))
+
+	_, got, err := Sniff(pr, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Sniffed{Format: InputCSV, Delimiter: ',', Header: true}
+	if got != want {
+		t.Errorf("Sniff() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSniffHeader(t *testing.T) {
+	tests := []struct {
+		records [][]string
+		want    bool
+	}{
+		{[][]string{{"name", "age"}, {"alice", "30"}, {"bob", "41"}}, true},
+		{[][]string{{"alice", "30"}, {"bob", "41"}, {"carol", "52"}}, false},
+		{[][]string{{"id", "code"}, {"1", "AB"}, {"2", "CD"}}, true},
+		{[][]string{{"XY", "EF"}, {"AB", "CD"}, {"GH", "IJ"}}, false},
+		{[][]string{{"1", "2"}, {"3", "4"}}, false},
+		{[][]string{{"a", "b"}, {"x", "y"}}, false},
+		{[][]string{{"a", "b"}, {"", ""}}, true},
+		{[][]string{{"a", "b"}}, true},
+		{[][]string{}, true},
+	}
+
+	for _, test := range tests {
+		if got := sniffHeader(test.records); got != test.want {
+			t.Errorf("sniffHeader(%q) = %v, want %v", test.records, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+// Row sources feed the UI with rows as they are loaded.
+
+package vxsv
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// RowSource is what the UI pulls rows from. Rows may keep arriving in the
+// background after the UI has started drawing, so Len can grow between
+// calls until Done reports true.
+type RowSource interface {
+	Header() []Column
+	Len() int
+	Row(idx int) []string
+	Done() bool
+	Err() error
+}
+
+// SQL NULL values are stored as this, which can't come up in text output,
+// to keep them apart from empty strings.
+const Null = "\x00"
+
+// NUL characters that do turn up in the input are shown as this instead,
+// so that they aren't taken for Null. Readers escape them before adding
+// any Null of their own, see escapeNul.
+const NulGlyph = "␀"
+
+func escapeNul(str string) string {
+	if strings.IndexByte(str, 0) < 0 {
+		return str
+	}
+
+	return strings.Replace(str, "\x00", NulGlyph, -1)
+}
+
+func escapeNuls(record []string) []string {
+	for i, cell := range record {
+		record[i] = escapeNul(cell)
+	}
+
+	return record
+}
+
+// A fully loaded table is a RowSource that is always done.
+func (d *TabularData) Header() []Column     { return d.Columns }
+func (d *TabularData) Len() int             { return len(d.Rows) }
+func (d *TabularData) Row(idx int) []string { return d.Rows[idx] }
+func (d *TabularData) Done() bool           { return true }
+func (d *TabularData) Err() error           { return nil }
+
+// Sources that can stop loading early.
+type cancelable interface {
+	Cancel()
+}
+
+// Sources that know how far through their input they are.
+type progressReporter interface {
+	Progress() (done, total int64)
+}
+
+// recordReader yields successive records from the input, along with the
+// offset (relative to where reading began) just past the end of each one.
+type recordReader interface {
+	Read() (record []string, end int64, err error)
+}
+
+// Readers whose records are worth keeping around as they were written,
+// see StreamSource.raw.
+type rawRecordReader interface {
+	lastRaw() []byte
+}
+
+// StreamSource loads records in a background goroutine.
+//
+// When the input is a regular file, only the byte offset of each record
+// is kept and rows are re-read from disk when asked for, so memory use
+// doesn't grow with the size of the file. Anything else (pipes, stdin)
+// is buffered in memory as it arrives.
+type StreamSource struct {
+	mu      sync.RWMutex
+	columns []Column
+	rows    [][]string
+	raws    [][]byte // Only kept for a rawRecordReader, and not indexed
+	offsets []int64
+	done    bool
+	err     error
+	stop    atomic.Bool
+
+	file   io.ReaderAt
+	base   int64
+	size   int64
+	decode func([]byte) ([]string, error)
+
+	// How NULL is printed in the input, "" if it can't be told apart
+	null string
+}
+
+// Must be called before the input is wrapped in any buffered reader, so
+// that the current file position is still accurate.
+func newStreamSource(input io.Reader, decode func([]byte) ([]string, error)) *StreamSource {
+	s := &StreamSource{decode: decode}
+
+	if file, ok := input.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			if base, err := file.Seek(0, io.SeekCurrent); err == nil {
+				s.file = file
+				s.base = base
+				s.size = info.Size() - base
+			}
+		}
+	}
+
+	return s
+}
+
+// Another source reading from the same input, for inputs holding more
+// than one table.
+func (s *StreamSource) sibling(decode func([]byte) ([]string, error)) *StreamSource {
+	return &StreamSource{file: s.file, base: s.base, size: s.size, decode: decode, null: s.null}
+}
+
+// Set the columns and the offset of the first record, must happen before
+// any rows are added.
+func (s *StreamSource) begin(columns []Column, start int64) {
+	s.columns = columns
+	s.offsets = []int64{start}
+}
+
+// Add a column found part way through loading, returning its index. Rows
+// read before then are padded out.
+func (s *StreamSource) addColumn(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.columns = append(s.columns, Column{Name: name, Width: displayWidth(name)})
+	return len(s.columns) - 1
+}
+
+func (s *StreamSource) indexed() bool {
+	return s.file != nil
+}
+
+// Replace cells printed as NULL with Null
+func (s *StreamSource) markNulls(record []string) []string {
+	if s.null == "" {
+		return record
+	}
+
+	for i, cell := range record {
+		if cell == s.null {
+			record[i] = Null
+		}
+	}
+
+	return record
+}
+
+func (s *StreamSource) add(record []string, end int64) {
+	record = s.markNulls(record)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.indexed() {
+		s.offsets = append(s.offsets, end)
+	} else {
+		s.rows = append(s.rows, record)
+	}
+
+	for j, cell := range record {
+		if j < len(s.columns) {
+			if width := displayWidth(cellText(cell)); width > s.columns[j].Width {
+				s.columns[j].Width = width
+			}
+		}
+	}
+}
+
+func (s *StreamSource) addRaw(raw []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.indexed() {
+		s.raws = append(s.raws, append([]byte{}, raw...))
+	}
+}
+
+func (s *StreamSource) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.done = true
+	s.err = err
+}
+
+// Read up to count records in total, meant to be run in a goroutine.
+func (s *StreamSource) load(reader recordReader, count int64) {
+	for int64(s.Len()) < count && !s.stop.Load() {
+		record, end, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			s.finish(err)
+			return
+		}
+
+		s.add(record, end)
+
+		if raws, ok := reader.(rawRecordReader); ok {
+			s.addRaw(raws.lastRaw())
+		}
+	}
+
+	s.finish(nil)
+}
+
+// Stop loading after the current record, keeping what has been read.
+func (s *StreamSource) Cancel() {
+	s.stop.Store(true)
+}
+
+// Only known for indexed files, total is 0 otherwise.
+func (s *StreamSource) Progress() (done, total int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.indexed() {
+		return 0, 0
+	}
+
+	return s.offsets[len(s.offsets)-1], s.size
+}
+
+func (s *StreamSource) Header() []Column {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	columns := make([]Column, len(s.columns))
+	copy(columns, s.columns)
+
+	return columns
+}
+
+func (s *StreamSource) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.indexed() {
+		return len(s.offsets) - 1
+	}
+
+	return len(s.rows)
+}
+
+func (s *StreamSource) Row(idx int) []string {
+	s.mu.RLock()
+	if !s.indexed() {
+		defer s.mu.RUnlock()
+
+		if row := s.rows[idx]; len(row) < len(s.columns) {
+			padded := make([]string, len(s.columns))
+			copy(padded, row)
+			return padded
+		}
+
+		return s.rows[idx]
+	}
+
+	width := len(s.columns)
+	s.mu.RUnlock()
+
+	row := make([]string, width)
+
+	buf := s.raw(idx)
+	if buf == nil {
+		return row
+	}
+
+	// The record parsed fine while indexing, so this can really only fail
+	// if the file changed underneath us.
+	if record, err := s.decode(buf); err == nil {
+		copy(row, s.markNulls(record))
+	}
+
+	return row
+}
+
+// The text a record was read from, nil if it wasn't kept.
+func (s *StreamSource) raw(idx int) []byte {
+	s.mu.RLock()
+	if !s.indexed() {
+		defer s.mu.RUnlock()
+
+		if idx < len(s.raws) {
+			return s.raws[idx]
+		}
+
+		return nil
+	}
+
+	start, end := s.offsets[idx], s.offsets[idx+1]
+	s.mu.RUnlock()
+
+	buf := make([]byte, end-start)
+	if _, err := s.file.ReadAt(buf, s.base+start); err != nil && err != io.EOF {
+		return nil
+	}
+
+	// Records are decoded again from this, the same way they were read
+	if bytes.IndexByte(buf, 0) >= 0 {
+		buf = bytes.Replace(buf, []byte{0}, []byte(NulGlyph), -1)
+	}
+
+	return buf
+}
+
+func (s *StreamSource) Done() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.done
+}
+
+func (s *StreamSource) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.err
+}
+
+// TableSet holds several tables read from the same input, e.g. psql
+// output of a script running more than one query along with any messages
+// printed in between, or the sheets of a workbook. Tables may keep being
+// added in the background until Done reports true.
+//
+// Used as a plain RowSource, it stands for the first table.
+type TableSet struct {
+	mu       sync.RWMutex
+	tables   []RowSource
+	names    []string // Empty unless the tables have names, e.g. sheets
+	messages []string
+	done     bool
+	err      error
+	stop     atomic.Bool
+}
+
+func (t *TableSet) add(name string, table RowSource) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tables = append(t.tables, table)
+	t.names = append(t.names, name)
+}
+
+func (t *TableSet) addMessage(msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, msg)
+}
+
+func (t *TableSet) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done = true
+	t.err = err
+}
+
+func (t *TableSet) Count() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return len(t.tables)
+}
+
+func (t *TableSet) Table(idx int) RowSource {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.tables[idx]
+}
+
+func (t *TableSet) Name(idx int) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.names[idx]
+}
+
+func (t *TableSet) Messages() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return append([]string{}, t.messages...)
+}
+
+func (t *TableSet) Header() []Column     { return t.Table(0).Header() }
+func (t *TableSet) Len() int             { return t.Table(0).Len() }
+func (t *TableSet) Row(idx int) []string { return t.Table(0).Row(idx) }
+
+func (t *TableSet) Done() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.done
+}
+
+func (t *TableSet) Err() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.err
+}
+
+// Stops loading the current table, and any after it.
+func (t *TableSet) Cancel() {
+	t.stop.Store(true)
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, table := range t.tables {
+		if table, ok := table.(cancelable); ok {
+			table.Cancel()
+		}
+	}
+}
+
+// Tables are read in order, so the last one knows how far along we are.
+func (t *TableSet) Progress() (done, total int64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if table, ok := t.tables[len(t.tables)-1].(progressReporter); ok {
+		return table.Progress()
+	}
+
+	return 0, 0
+}
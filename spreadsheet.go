@@ -0,0 +1,293 @@
+// Reading Excel (.xlsx) and OpenDocument (.ods) workbooks.
+
+package vxsv
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Both kinds of workbook are zip files
+var zipMagic = []byte("PK\x03\x04")
+
+// Turn the rows of a sheet into a table of at most count rows, padding out
+// short rows. Sheets without any rows are nil.
+func newSheet(rows [][]string, readHeader bool, count int64) *TabularData {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	if width == 0 {
+		return nil
+	}
+
+	columns := make([]Column, width)
+	for i := range columns {
+		columns[i].Name = fmt.Sprintf("[%d]", i)
+	}
+
+	if readHeader {
+		for i, name := range rows[0] {
+			if name != "" {
+				columns[i].Name = name
+			}
+		}
+
+		rows = rows[1:]
+	}
+
+	if int64(len(rows)) > count {
+		rows = rows[:count]
+	}
+
+	for i := range columns {
+		columns[i].Width = displayWidth(columns[i].Name)
+	}
+
+	for i, row := range rows {
+		if len(row) < width {
+			padded := make([]string, width)
+			copy(padded, row)
+			rows[i] = padded
+		}
+
+		for j, cell := range rows[i] {
+			if cellWidth := displayWidth(cellText(cell)); cellWidth > columns[j].Width {
+				columns[j].Width = cellWidth
+			}
+		}
+	}
+
+	return &TabularData{Columns: columns, Rows: rows}
+}
+
+// Values as Excel displays them, so formulas show their cached result and
+// dates come out formatted.
+func readXLSX(data []byte, readHeader bool, count int64, sheets *TableSet) error {
+	book, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer book.Close()
+
+	for _, name := range book.GetSheetList() {
+		rows, err := book.GetRows(name)
+		if err != nil {
+			return err
+		}
+
+		if sheet := newSheet(rows, readHeader, count); sheet != nil {
+			sheets.add(name, sheet)
+		}
+	}
+
+	return nil
+}
+
+// Reads content.xml, where each cell holds the text it's displayed as
+// (formatted dates, results of formulas) as paragraphs:
+//
+//	<table:table table:name="Sheet1">
+//	  <table:table-row>
+//	    <table:table-cell office:value-type="float" office:value="1">
+//	      <text:p>1</text:p>
+//	    </table:table-cell>
+//
+// Rows and cells can be repeated, which is how the empty space at the
+// end of a sheet is written, so trailing empty ones are dropped.
+func readODS(archive *zip.Reader, readHeader bool, count int64, sheets *TableSet) error {
+	content, err := archive.Open("content.xml")
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	dec := xml.NewDecoder(content)
+
+	// Rows past this many are only skipped over
+	limit := count
+	if readHeader && limit < math.MaxInt64 {
+		limit++
+	}
+
+	var name string
+	var rows [][]string
+	var row []string
+	var cell strings.Builder
+	var paragraphs []string
+
+	rowRepeat, cellRepeat := 1, 1
+	emptyRows, emptyCells := 0, 0
+	inParagraph, skipDepth := false, 0
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 {
+				skipDepth++
+				continue
+			}
+
+			switch tok.Name.Local {
+			case "annotation":
+				// Comments attached to a cell aren't part of its value
+				skipDepth = 1
+			case "table":
+				name = odsAttr(tok, "name")
+				rows, emptyRows = nil, 0
+			case "table-row":
+				row, emptyCells = nil, 0
+				rowRepeat = odsRepeat(tok, "number-rows-repeated")
+			case "table-cell", "covered-table-cell":
+				paragraphs = nil
+				cellRepeat = odsRepeat(tok, "number-columns-repeated")
+			case "p", "h":
+				inParagraph = true
+				cell.Reset()
+			case "s":
+				cell.WriteString(strings.Repeat(" ", odsRepeat(tok, "c")))
+			case "tab":
+				cell.WriteString("\t")
+			case "line-break":
+				cell.WriteString("\n")
+			}
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+
+			switch tok.Name.Local {
+			case "p", "h":
+				inParagraph = false
+				paragraphs = append(paragraphs, cell.String())
+			case "table-cell", "covered-table-cell":
+				value := strings.Join(paragraphs, "\n")
+
+				if value == "" {
+					emptyCells += cellRepeat
+					continue
+				}
+
+				for ; emptyCells > 0; emptyCells-- {
+					row = append(row, "")
+				}
+
+				for i := 0; i < cellRepeat; i++ {
+					row = append(row, value)
+				}
+			case "table-row":
+				if len(row) == 0 {
+					emptyRows += rowRepeat
+					continue
+				}
+
+				for ; emptyRows > 0 && int64(len(rows)) < limit; emptyRows-- {
+					rows = append(rows, []string{})
+				}
+
+				for i := 0; i < rowRepeat && int64(len(rows)) < limit; i++ {
+					rows = append(rows, append([]string{}, row...))
+				}
+			case "table":
+				if sheet := newSheet(rows, readHeader, count); sheet != nil {
+					sheets.add(name, sheet)
+				}
+			}
+		case xml.CharData:
+			if inParagraph && skipDepth == 0 {
+				cell.Write(tok)
+			}
+		}
+	}
+
+	return nil
+}
+
+func odsAttr(elem xml.StartElement, name string) string {
+	for _, attr := range elem.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// Repeat counts default to 1
+func odsRepeat(elem xml.StartElement, name string) int {
+	if count, err := strconv.Atoi(odsAttr(elem, name)); err == nil && count > 0 {
+		return count
+	}
+
+	return 1
+}
+
+func hasFile(archive *zip.Reader, name string) bool {
+	for _, file := range archive.File {
+		if file.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reads every sheet of an .xlsx or .ods workbook, which can be switched
+// between like psql result sets. Empty sheets are left out. The whole
+// workbook is read into memory, but at most count rows of each sheet are
+// kept.
+func ReadSpreadsheet(reader io.Reader, readHeader bool, count int64) (RowSource, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	sheets := &TableSet{}
+
+	switch {
+	case hasFile(archive, "xl/workbook.xml"):
+		err = readXLSX(data, readHeader, count, sheets)
+	case hasFile(archive, "content.xml"):
+		err = readODS(archive, readHeader, count, sheets)
+	default:
+		err = errors.New("Not an .xlsx or .ods workbook")
+	}
+
+	if err != nil {
+		return nil, err
+	} else if sheets.Count() == 0 {
+		return nil, errors.New("No sheets with data found")
+	}
+
+	sheets.finish(nil)
+	return sheets, nil
+}
@@ -0,0 +1,167 @@
+package vxsv
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type readSheet struct {
+	name string
+	readTable
+}
+
+func readSheets(t *testing.T, data []byte, readHeader bool, count int64) []readSheet {
+	t.Helper()
+
+	source, err := ReadSpreadsheet(bytes.NewReader(data), readHeader, count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := source.(*TableSet)
+	tables, _ := readTables(t, set)
+
+	sheets := []readSheet{}
+	for i, table := range tables {
+		sheets = append(sheets, readSheet{set.Name(i), table})
+	}
+
+	return sheets
+}
+
+func testXLSX(t *testing.T) []byte {
+	book := excelize.NewFile()
+	defer book.Close()
+
+	book.SetSheetName("Sheet1", "people")
+	book.SetSheetRow("people", "A1", &[]interface{}{"name", "age"})
+	book.SetSheetRow("people", "A2", &[]interface{}{"alice", 30})
+	book.SetSheetRow("people", "A3", &[]interface{}{"bob"})
+	book.SetCellFormula("people", "B3", "B2+1")
+	book.SetSheetRow("people", "A4", &[]interface{}{"carol", 52, "extra"})
+
+	book.NewSheet("empty")
+
+	book.NewSheet("totals")
+	book.SetSheetRow("totals", "A1", &[]interface{}{"sum"})
+	book.SetSheetRow("totals", "A2", &[]interface{}{1.5})
+
+	buf, err := book.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestReadSpreadsheetXLSX(t *testing.T) {
+	data := testXLSX(t)
+
+	want := []readSheet{
+		{"people", readTable{[]string{"name", "age", "[2]"}, [][]string{{"alice", "30", ""}, {"bob", "", ""}, {"carol", "52", "extra"}}}},
+		{"totals", readTable{[]string{"sum"}, [][]string{{"1.5"}}}},
+	}
+
+	if got := readSheets(t, data, true, 100); !reflect.DeepEqual(got, want) {
+		t.Errorf("read %q, want %q", got, want)
+	}
+
+	// At most count rows of each sheet
+	want = []readSheet{
+		{"people", readTable{[]string{"[0]", "[1]", "[2]"}, [][]string{{"name", "age", ""}}}},
+		{"totals", readTable{[]string{"[0]"}, [][]string{{"sum"}}}},
+	}
+
+	if got := readSheets(t, data, false, 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("with a count of 1, read %q, want %q", got, want)
+	}
+}
+
+const testODSContent = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content
+    xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+    xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+    xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+  <office:body><office:spreadsheet>
+    <table:table table:name="first">
+      <table:table-row>
+        <table:table-cell><text:p>id</text:p></table:table-cell>
+        <table:table-cell><text:p>note</text:p></table:table-cell>
+      </table:table-row>
+      <table:table-row>
+        <table:table-cell office:value-type="float" office:value="1"><text:p>1</text:p></table:table-cell>
+        <table:table-cell>
+          <office:annotation><text:p>a comment</text:p></office:annotation>
+          <text:p>two<text:s text:c="2"/>spaces</text:p><text:p>second line</text:p>
+        </table:table-cell>
+      </table:table-row>
+      <table:table-row table:number-rows-repeated="2">
+        <table:table-cell table:number-columns-repeated="2"><text:p>x</text:p></table:table-cell>
+      </table:table-row>
+      <table:table-row table:number-rows-repeated="1000">
+        <table:table-cell table:number-columns-repeated="1024"/>
+      </table:table-row>
+    </table:table>
+    <table:table table:name="blank">
+      <table:table-row><table:table-cell/></table:table-row>
+    </table:table>
+  </office:spreadsheet></office:body>
+</office:document-content>`
+
+func testODS(t *testing.T) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	for name, content := range map[string]string{
+		"mimetype":    "application/vnd.oasis.opendocument.spreadsheet",
+		"content.xml": testODSContent,
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Write([]byte(content))
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestReadSpreadsheetODS(t *testing.T) {
+	data := testODS(t)
+
+	want := []readSheet{
+		{"first", readTable{[]string{"id", "note"}, [][]string{{"1", "two  spaces\nsecond line"}, {"x", "x"}, {"x", "x"}}}},
+	}
+
+	if got := readSheets(t, data, true, 100); !reflect.DeepEqual(got, want) {
+		t.Errorf("read %q, want %q", got, want)
+	}
+
+	want[0].rows = want[0].rows[:2]
+
+	if got := readSheets(t, data, true, 2); !reflect.DeepEqual(got, want) {
+		t.Errorf("with a count of 2, read %q, want %q", got, want)
+	}
+}
+
+func TestReadSpreadsheetErrors(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	archive.Create("other.txt")
+	archive.Close()
+
+	for _, data := range [][]byte{[]byte("not a zip"), buf.Bytes()} {
+		if _, err := ReadSpreadsheet(bytes.NewReader(data), true, 100); err == nil {
+			t.Errorf("ReadSpreadsheet(%q) succeeded, want an error", data)
+		}
+	}
+}
@@ -2,131 +2,942 @@ package vxsv
 
 import (
 	"bufio"
+	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
 )
 
+// Reads the input line by line, keeping track of how far into it we are.
+type lineReader struct {
+	reader *bufio.Reader
+	offset int64
+
+	// The last line read, kept around for UnreadLine
+	last     string
+	lastSize int
+	unread   bool
+}
+
+func newLineReader(reader io.Reader) *lineReader {
+	return &lineReader{reader: bufio.NewReader(reader)}
+}
+
+// Returns the next line without its line ending.
+func (l *lineReader) ReadLine() (string, error) {
+	if l.unread {
+		l.unread = false
+		l.offset += int64(l.lastSize)
+		return l.last, nil
+	}
+
+	line, err := l.reader.ReadString('\n')
+	l.offset += int64(len(line))
+
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+
+	l.last = escapeNul(strings.TrimRight(line, "\r\n"))
+	l.lastSize = len(line)
+
+	return l.last, err
+}
+
+// Push the last line back, so that the next ReadLine returns it again.
+func (l *lineReader) UnreadLine() {
+	l.unread = true
+	l.offset -= int64(l.lastSize)
+}
+
+type psqlRecords struct {
+	lines  *lineReader
+	layout []cellSpan
+}
+
+func (r *psqlRecords) Read() ([]string, int64, error) {
+	line, err := r.lines.ReadLine()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// This is the last line that's printed, e.g. (100 rows), or the
+	// bottom border with \pset border 2
+	if len(line) == 0 || isRowCount(line) || isSeparatorLine(line) {
+		return nil, 0, io.EOF
+	}
+
+	lines := []string{line}
+
+	// Values containing newlines span several lines, we only know the
+	// row is over once we've seen a line that doesn't continue it.
+	for {
+		next, err := r.lines.ReadLine()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		if !continuesRow(r.layout, line, next) {
+			r.lines.UnreadLine()
+			break
+		}
+
+		lines = append(lines, next)
+		line = next
+	}
+
+	return parsePSQLRow(r.layout, lines), r.lines.offset, nil
+}
+
+// Splits a record spanning several lines back up into them.
+func splitLines(buf []byte) []string {
+	lines := strings.Split(strings.TrimRight(string(buf), "\r\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+
+	return lines
+}
+
 // Parses Postgres output format:
 //
-//  colA | colB | colC
-// ------+------+-----
-//  foo  | bar  | baz
-//  foo2 | bar2 | baz2
-// (2 rows)
-func ReadPSQLTable(reader io.Reader, count int64) (*TabularData, error) {
-	scanner := bufio.NewScanner(reader)
-	scanner.Scan()
-
-	columnString := scanner.Text()
-	columns := parseColumns(columnString)
-
-	// Skip the horizontal line
-	scanner.Scan()
-
-	rows := [][]string{}
-
-	var i int64
-	for i = 0; i < count && scanner.Scan(); i++ {
-		// This is the last line that's printed, e.g. (100 rows)
-		if scanner.Text()[0] == '(' {
+//	 colA | colB | colC
+//	------+------+-----
+//	 foo  | bar  | baz
+//	 foo2 | bar2 | baz2
+//	(2 rows)
+//
+// Values containing newlines continue on the following lines, see
+// parsePSQLRow. Expanded output (\x) is detected and handled as well,
+// see expandedTable.
+//
+// Scripts running several queries print a table for each, with messages
+// such as "INSERT 0 1" or "NOTICE: ..." in between. Every table is read
+// into the returned TableSet, and the messages are kept alongside them.
+//
+// Cells printed as null (set with \pset null) are read as Null, unless
+// it's empty.
+func ReadPSQLTable(reader io.Reader, null string, count int64) (RowSource, error) {
+	input := newStreamSource(reader, nil)
+	input.null = null
+
+	r := &psqlReader{
+		input: input,
+		lines: newLineReader(reader),
+		set:   &TableSet{},
+		count: count,
+	}
+
+	// Find the first table before handing anything over to the UI
+	table, records, err := r.nextTable()
+	if err != nil {
+		return nil, err
+	} else if table == nil {
+		return nil, fmt.Errorf("No tables found in input: %s", strings.Join(r.set.Messages(), "; "))
+	}
+
+	go r.loadTables(table, records)
+
+	return r.set, nil
+}
+
+type psqlReader struct {
+	input *StreamSource // Only used to create a source for each table
+	lines *lineReader
+	set   *TableSet
+	count int64
+}
+
+// Line between the header and the rows, e.g. "----+------"
+func isSeparatorLine(line string) bool {
+	return asciiRule(line) != ""
+}
+
+// Printed after each table, e.g. (2 rows)
+func isRowCount(line string) bool {
+	if !strings.HasPrefix(line, "(") || !strings.HasSuffix(line, ")") {
+		return false
+	}
+
+	fields := strings.Fields(line[1 : len(line)-1])
+	if len(fields) != 2 || (fields[1] != "row" && fields[1] != "rows") {
+		return false
+	}
+
+	_, err := strconv.Atoi(fields[0])
+	return err == nil
+}
+
+// Skips ahead to the next table, collecting any messages on the way. The
+// table is nil once the input runs out.
+func (r *psqlReader) nextTable() (*StreamSource, recordReader, error) {
+	for {
+		start := r.lines.offset
+
+		line, err := r.lines.ReadLine()
+		if err == io.EOF {
+			return nil, nil, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		if isExpandedHeader(line) {
+			return r.expandedTable(start)
+		} else if strings.TrimSpace(line) == "" || isRowCount(line) {
+			continue
+		} else if isSeparatorLine(line) {
+			// Top border with \pset border 2
+			continue
+		}
+
+		// Headers are only recognizable by the line after them
+		next, err := r.lines.ReadLine()
+		if err == nil && isSeparatorLine(next) {
+			return r.alignedTable(line, next)
+		} else if err == nil {
+			r.lines.UnreadLine()
+		} else if err != io.EOF {
+			return nil, nil, err
+		}
+
+		r.set.addMessage(line)
+	}
+}
+
+// The header and separator have already been read.
+func (r *psqlReader) alignedTable(header, separator string) (*StreamSource, recordReader, error) {
+	layout := parseLayout(separator)
+
+	table := r.input.sibling(func(buf []byte) ([]string, error) {
+		return parsePSQLRow(layout, splitLines(buf)), nil
+	})
+
+	table.begin(parseColumns(layout, header), r.lines.offset)
+	r.set.add("", table)
+
+	return table, &psqlRecords{r.lines, layout}, nil
+}
+
+// Load each table in turn, meant to be run in a goroutine.
+func (r *psqlReader) loadTables(table *StreamSource, records recordReader) {
+	for table != nil {
+		if r.set.stop.Load() {
+			table.Cancel()
+		}
+
+		table.load(records, r.count)
+
+		if err := table.Err(); err != nil {
+			r.set.finish(err)
+			return
+		} else if r.set.stop.Load() {
 			break
 		}
 
-		rows = append(rows, parseRow(columns, scanner.Text()))
+		// Skip whatever is left of a table cut short by the row limit
+		if int64(table.Len()) >= r.count {
+			for {
+				if _, _, err := records.Read(); err != nil {
+					break
+				}
+			}
+		}
+
+		var err error
+		if table, records, err = r.nextTable(); err != nil {
+			r.set.finish(err)
+			return
+		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	r.set.finish(nil)
+}
+
+// Each record in expanded output starts with a line like this, possibly
+// with a leading "+" when borders are enabled, or drawn with box drawing
+// characters.
+func isExpandedHeader(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(ruleReplacer.Replace(line), "+"), "-[ RECORD ")
+}
+
+// Records printed one after the other as blocks of lines, each starting
+// with a header line, such as psql's expanded or mysql's vertical output.
+type blockRecords struct {
+	lines   *lineReader
+	columns []Column
+	done    bool
+
+	isHeader func(line string) bool
+	isEnd    func(line string) bool
+	parse    func(columns []Column, lines []string) []string
+}
+
+// Reads up to the next record header, which has already been consumed
+// by the time this is called.
+func (r *blockRecords) readLines() (lines []string, end int64, err error) {
+	for {
+		end = r.lines.offset
+
+		line, err := r.lines.ReadLine()
+		if err == io.EOF {
+			r.done = true
+			return trimBlankLines(lines), end, nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		if r.isHeader(line) {
+			return lines, end, nil
+		}
+
+		if r.isEnd(line) {
+			r.done = true
+			return trimBlankLines(lines), end, nil
+		}
+
+		lines = append(lines, line)
+	}
+}
+
+// Blank lines after the last record are spacing, not part of its value
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+func (r *blockRecords) Read() ([]string, int64, error) {
+	if r.done {
+		return nil, 0, io.EOF
 	}
 
-	return &TabularData{
-		Columns: columns,
-		Rows:    rows,
-	}, nil
+	lines, end, err := r.readLines()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return r.parse(r.columns, lines), end, nil
+}
+
+// Parses expanded output, where each record is printed as a block of
+// name / value pairs:
+//
+//	-[ RECORD 1 ]-
+//	colA | foo
+//	colB | bar
+//	-[ RECORD 2 ]-
+//	colA | foo2
+//	colB | bar2
+//
+// The header of the first record, starting at start, has already been
+// read. The rest of that record is read right away to find the column
+// names.
+func (r *psqlReader) expandedTable(start int64) (*StreamSource, recordReader, error) {
+	records := &blockRecords{
+		lines:    r.lines,
+		isHeader: isExpandedHeader,
+		parse:    parseExpandedRecord,
+
+		// Trailing blank line and/or "(N rows)"
+		isEnd: func(line string) bool {
+			return len(line) == 0 || isRowCount(line)
+		},
+	}
+
+	first, end, err := records.readLines()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names, values := parseExpandedFields(first)
+
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		columns[i] = Column{Name: name, Width: displayWidth(name)}
+	}
+
+	records.columns = columns
+
+	// Records are stored along with their header line
+	table := r.input.sibling(func(buf []byte) ([]string, error) {
+		return parseExpandedRecord(columns, splitLines(buf)[1:]), nil
+	})
+
+	table.begin(append([]Column{}, columns...), start)
+
+	if r.count > 0 {
+		table.add(values, end)
+	}
+
+	r.set.add("", table)
+
+	return table, records, nil
+}
+
+// "name | value" -> ("name", "value"), or "name │ value" in the unicode
+// line style.
+func splitExpandedLine(line string) (string, string) {
+	line = strings.Trim(line, "|│")
+
+	idx := strings.IndexAny(line, "|│")
+	if idx < 0 {
+		return strings.TrimSpace(line), ""
+	}
+
+	_, size := utf8.DecodeRuneInString(line[idx:])
+
+	// Leave the indentation of continued values alone
+	value := strings.TrimRight(strings.TrimPrefix(line[idx+size:], " "), " ")
+
+	return strings.TrimSpace(line[:idx]), value
+}
+
+// Lines without a name continue the value of the field above them, which
+// then ends in a newline or wrap marker.
+func parseExpandedFields(lines []string) (names, values []string) {
+	for _, line := range lines {
+		// Borders when printed with \pset border 2
+		if strings.HasPrefix(ruleReplacer.Replace(line), "+-") {
+			continue
+		}
+
+		name, value := splitExpandedLine(line)
+
+		if name != "" || len(values) == 0 {
+			names = append(names, name)
+			values = append(values, value)
+			continue
+		}
+
+		last := &values[len(values)-1]
+		if marker, size := utf8.DecodeLastRuneInString(*last); isNewlineMarker(marker) || isWrapMarker(marker) {
+			*last = strings.TrimRight((*last)[:len(*last)-size], " ")
+
+			if isNewlineMarker(marker) {
+				*last += "\n"
+			}
+		}
+
+		*last += value
+	}
+
+	return names, values
+}
+
+func parseExpandedRecord(columns []Column, lines []string) []string {
+	row := make([]string, len(columns))
+	_, values := parseExpandedFields(lines)
+
+	copy(row, values)
+
+	return row
+}
+
+type mysqlRecords struct {
+	lines  *lineReader
+	layout []cellSpan
+}
+
+func (r *mysqlRecords) Read() ([]string, int64, error) {
+	row, err := r.lines.ReadLine()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// last line
+	if len(row) == 0 || row[0] == '+' {
+		return nil, 0, io.EOF
+	}
+
+	// The mysql client prints newlines in values as they are, so keep
+	// going until we find the end of the row.
+	for !strings.HasSuffix(row, " |") {
+		next, err := r.lines.ReadLine()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		row += "\n" + next
+	}
+
+	return parseRow(r.layout, row), r.lines.offset, nil
 }
 
 // Parses MySQL output format:
 //
-// +------+------+------+
-// | colA | colB | colC |
-// +------+------+------+
-// | foo  | bar  | baz  |
-// | foo2 | bar2 | baz2 |
-// +------+------+------+
-// 2 rows in set
-func ReadMySQLTable(reader io.Reader, count int64) (*TabularData, error) {
-	scanner := bufio.NewScanner(reader)
-
-	// Skip leading horizontal line
-	scanner.Scan()
-
-	scanner.Scan()
-	columnString := scanner.Text()
-	columns := parseColumns(columnString[1 : len(columnString)-2])
+//	+------+------+------+
+//	| colA | colB | colC |
+//	+------+------+------+
+//	| foo  | bar  | baz  |
+//	| foo2 | bar2 | baz2 |
+//	+------+------+------+
+//	2 rows in set
+//
+// Values containing newlines are printed as they are, breaking the row
+// over several lines. Vertical output (\G) is detected and handled as
+// well, see readMySQLVertical.
+//
+// Cells printed as null (normally NULL) are read as Null.
+func ReadMySQLTable(reader io.Reader, null string, count int64) (RowSource, error) {
+	input := newStreamSource(reader, nil)
+	input.null = null
+	lines := newLineReader(reader)
+
+	// The leading horizontal line tells us where the columns are
+	first, err := lines.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if isVerticalHeader(first) {
+		return readMySQLVertical(input, lines, count)
+	}
+
+	layout := parseLayout(first)
+
+	columnString, err := lines.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	source := input.sibling(func(buf []byte) ([]string, error) {
+		row := strings.Replace(string(buf), "\r\n", "\n", -1)
+		return parseRow(layout, strings.TrimRight(row, "\n")), nil
+	})
 
 	// Skip trailing horizontal line
-	scanner.Scan()
+	if _, err := lines.ReadLine(); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	source.begin(parseColumns(layout, columnString), lines.offset)
+	go source.load(&mysqlRecords{lines, layout}, count)
+
+	return source, nil
+}
+
+// "2 rows in set (0.00 sec)", "1 row in set, 1 warning (0.00 sec)" or
+// "Empty set (0.00 sec)"
+func isMySQLFooter(line string) bool {
+	if strings.HasPrefix(line, "Empty set") {
+		return true
+	}
 
-	rows := [][]string{}
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[2] != "in" || strings.TrimSuffix(fields[3], ",") != "set" {
+		return false
+	}
+
+	_, err := strconv.Atoi(fields[0])
+	return err == nil
+}
+
+// *************************** 1. row ***************************
+func isVerticalHeader(line string) bool {
+	return strings.HasPrefix(line, "***") && strings.HasSuffix(line, "***") &&
+		strings.Contains(line, ". row ")
+}
+
+// Parses vertical output, where each record is printed as a block of
+// name: value pairs with the names lined up on the colon:
+//
+//	*************************** 1. row ***************************
+//	  id: 1
+//	name: foo
+//	*************************** 2. row ***************************
+//	  id: 2
+//	name: bar
+//	2 rows in set
+//
+// The header of the first record has already been read, the rest of it
+// is read right away to find the column names.
+func readMySQLVertical(input *StreamSource, lines *lineReader, count int64) (RowSource, error) {
+	records := &blockRecords{
+		lines:    lines,
+		isHeader: isVerticalHeader,
+		parse:    parseVerticalRecord,
+
+		// Values can contain blank lines, so only the footer ends it
+		isEnd: isMySQLFooter,
+	}
 
-	var i int64
-	for i = 0; i < count && scanner.Scan(); i++ {
-		row := scanner.Text()
+	first, end, err := records.readLines()
+	if err != nil {
+		return nil, err
+	}
+
+	names, values := parseVerticalFields(nil, first)
+
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		columns[i] = Column{Name: name, Width: displayWidth(name)}
+	}
+
+	records.columns = columns
+
+	// Records are stored along with their header line
+	source := input.sibling(func(buf []byte) ([]string, error) {
+		return parseVerticalRecord(columns, splitLines(buf)[1:]), nil
+	})
+
+	source.begin(append([]Column{}, columns...), 0)
+
+	if count > 0 {
+		source.add(values, end)
+	}
 
-		// last line
-		if row[0] == '+' {
+	go source.load(records, count)
+
+	return source, nil
+}
+
+// Every name is padded to the same width, so the colon of the first line
+// tells us where the values start. Whether that's the same number of bytes
+// or of cells into the line depends on the client, so either is accepted.
+// Once the names are known, after the first record, each line is instead
+// matched against the next expected name. Lines that aren't the next field
+// are part of a value containing newlines.
+func parseVerticalFields(known []string, lines []string) (names, values []string) {
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	sep := strings.Index(lines[0], ": ")
+	if sep < 0 {
+		sep = strings.Index(lines[0], ":")
+	}
+
+	col := -1
+	if sep >= 0 {
+		col = displayWidth(lines[0][:sep])
+	}
+
+	for _, line := range lines {
+		name, value, isField := "", "", false
+
+		if known != nil {
+			if len(values) < len(known) {
+				name = known[len(values)]
+				value, isField = cutVerticalField(line, name)
+			}
+		} else if idx := verticalColon(line, sep, col); idx >= 0 {
+			name, isField = strings.TrimSpace(line[:idx]), true
+			value, _ = cutVerticalField(line[idx:], "")
+		}
+
+		if !isField || name == "" {
+			if len(values) > 0 {
+				values[len(values)-1] += "\n" + line
+			}
+
+			continue
+		}
+
+		names = append(names, name)
+		values = append(values, value)
+	}
+
+	return names, values
+}
+
+// Byte index of the colon after a name, found either sep bytes or col
+// cells into the line. -1 if there's none in either place.
+func verticalColon(line string, sep, col int) int {
+	isColon := func(idx int) bool {
+		return idx >= 0 && idx < len(line) && line[idx] == ':' &&
+			(idx+1 == len(line) || line[idx+1] == ' ')
+	}
+
+	if isColon(sep) {
+		return sep
+	}
+
+	x, idx := 0, 0
+	for _, g := range glyphs(line) {
+		if x >= col {
 			break
 		}
 
-		rows = append(rows, parseRow(columns, row[1:len(row)-2]))
+		x += g.width
+		idx += len(g.text)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	if x == col && isColon(idx) {
+		return idx
 	}
 
-	return &TabularData{
-		Columns: columns,
-		Rows:    rows,
-	}, nil
+	return -1
 }
 
-func parseColumns(columnString string) []Column {
-	split := strings.Split(columnString, " | ")
+// The value of a line starting with the given name (after any padding)
+// and a colon.
+func cutVerticalField(line, name string) (string, bool) {
+	rest := strings.TrimLeft(line, " ")
+	if !strings.HasPrefix(rest, name+":") {
+		return "", false
+	}
+
+	rest = rest[len(name)+1:]
+	if rest == "" {
+		return "", true
+	} else if rest[0] != ' ' {
+		return "", false
+	}
 
-	columns := make([]Column, len(split))
+	return rest[1:], true
+}
 
-	for i, col := range split {
-		columns[i] = Column{
-			Name:  strings.TrimSpace(col),
-			Width: len(col),
+func parseVerticalRecord(columns []Column, lines []string) []string {
+	known := make([]string, len(columns))
+	for i, col := range columns {
+		known[i] = col.Name
+	}
+
+	row := make([]string, len(columns))
+	_, values := parseVerticalFields(known, lines)
+
+	copy(row, values)
+
+	return row
+}
+
+// Where a column's cells are within a line, in terminal columns. Both
+// psql and mysql pad cells to how wide they show up on screen rather
+// than their length in bytes.
+type cellSpan struct {
+	start, width int
+}
+
+// Box drawing characters of psql's unicode line style
+var ruleReplacer = strings.NewReplacer(
+	"─", "-", "┼", "+", "├", "+", "┤", "+", "┬", "+", "┴", "+",
+	"┌", "+", "┐", "+", "└", "+", "┘", "+",
+)
+
+// Turns separator lines such as "----+------" or "+----+------+" into
+// ascii, returns "" for anything else.
+func asciiRule(line string) string {
+	rule := ruleReplacer.Replace(line)
+
+	if !strings.Contains(rule, "-") || strings.Trim(rule, "-+ ") != "" {
+		return ""
+	}
+
+	return rule
+}
+
+// Finds the columns from the runs of dashes in a separator line. These
+// include a dash of padding on either side, except for psql tables
+// without any borders, which look like "-- ----".
+func parseLayout(separator string) []cellSpan {
+	rule := asciiRule(separator)
+	runs := []cellSpan{}
+
+	for i := 0; i < len(rule); i++ {
+		if rule[i] != '-' {
+			continue
+		}
+
+		start := i
+		for i < len(rule) && rule[i] == '-' {
+			i++
 		}
+
+		runs = append(runs, cellSpan{start, i - start})
+	}
+
+	margin := 1
+	if !strings.Contains(rule, "+") && len(runs) > 1 {
+		margin = 0
+	}
+
+	for i := range runs {
+		runs[i].start += margin
+		runs[i].width = clamp(runs[i].width-2*margin, 0, runs[i].width)
 	}
 
-	// Make sure we skip the leading space in the first column
-	columns[0].Width--
+	return runs
+}
+
+func parseColumns(layout []cellSpan, header string) []Column {
+	columns := make([]Column, len(layout))
+
+	for i, name := range splitRow(layout, header) {
+		columns[i] = Column{
+			Name:  strings.TrimSpace(name),
+			Width: layout[i].width,
+		}
+	}
 
 	return columns
 }
 
-// TODO: doesn't handle multi-line rows
-func parseRow(columns []Column, str string) []string {
-	row := make([]string, len(columns))
+// A line along with the byte offset of each terminal column in it.
+type displayLine struct {
+	text    string
+	offsets []int
+}
 
-	// Skip leading space
-	offset := 1
+func newDisplayLine(text string) displayLine {
+	offsets := make([]int, 0, len(text)+1)
 
-	for i, col := range columns {
-		// Make sure we don't over shoot the string length
-		if offset+col.Width >= len(str) {
-			row[i] = str[offset:len(str)]
-		} else {
-			row[i] = str[offset : offset+col.Width]
+	for i, r := range text {
+		width := runewidth.RuneWidth(r)
+
+		// Newlines printed as they are by mysql take up a column
+		if r < ' ' {
+			width = 1
+		}
+
+		for j := 0; j < width; j++ {
+			offsets = append(offsets, i)
 		}
+	}
+
+	return displayLine{text, append(offsets, len(text))}
+}
+
+// Byte offset of a terminal column, clamped to the ends of the line
+func (l displayLine) offset(pos int) int {
+	if pos < 0 {
+		return 0
+	} else if pos >= len(l.offsets) {
+		return len(l.text)
+	}
+
+	return l.offsets[pos]
+}
 
+func (l displayLine) slice(start, end int) string {
+	return l.text[l.offset(start):l.offset(end)]
+}
+
+// The character at a terminal column, ' ' past the end of the line
+func (l displayLine) at(pos int) rune {
+	if pos < 0 || pos >= len(l.offsets)-1 {
+		return ' '
+	}
+
+	r, _ := utf8.DecodeRuneInString(l.text[l.offsets[pos]:])
+	return r
+}
+
+// Markers psql prints next to values that continue on the next line.
+// The ascii and unicode styles put them in the right margin of the cell,
+// old-ascii replaces the column separator left of the continuation.
+const (
+	psqlNewline        = '+'
+	psqlWrap           = '.'
+	psqlUnicodeNewline = '↵'
+	psqlUnicodeWrap    = '…'
+	psqlOldNewline     = ':'
+	psqlOldWrap        = ';'
+)
+
+func isNewlineMarker(ch rune) bool {
+	return ch == psqlNewline || ch == psqlUnicodeNewline
+}
+
+func isWrapMarker(ch rune) bool {
+	return ch == psqlWrap || ch == psqlUnicodeWrap
+}
+
+// The character in the right margin of each cell of the line, and the
+// separator to its left (' ' for the first column).
+func cellMargins(layout []cellSpan, line string) (left, right []rune) {
+	left = make([]rune, len(layout))
+	right = make([]rune, len(layout))
+
+	display := newDisplayLine(line)
+
+	for i, span := range layout {
+		left[i] = ' '
+		if i > 0 {
+			left[i] = display.at(span.start - 2)
+		}
+
+		right[i] = display.at(span.start + span.width)
+	}
+
+	return left, right
+}
+
+// Whether next holds more of the values in line
+func continuesRow(layout []cellSpan, line, next string) bool {
+	_, right := cellMargins(layout, line)
+	left, _ := cellMargins(layout, next)
+
+	for i := range layout {
+		if isNewlineMarker(right[i]) || isWrapMarker(right[i]) ||
+			left[i] == psqlOldNewline || left[i] == psqlOldWrap {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Merges a row spread over several lines back together. Lines that wrap
+// are joined as they are, values continued after a newline get it back.
+//
+//	 colA | colB
+//	------+------
+//	 foo +| bar
+//	 baz  |
+func parsePSQLRow(layout []cellSpan, lines []string) []string {
+	row := make([]string, len(layout))
+
+	var above []rune
+
+	for k, line := range lines {
+		left, right := cellMargins(layout, line)
+
+		for i, cell := range splitRow(layout, line) {
+			// Continuation lines keep their indentation
+			cell = strings.TrimRight(cell, " ")
+
+			switch {
+			case k == 0:
+				row[i] = strings.TrimSpace(cell)
+			case isNewlineMarker(above[i]) || left[i] == psqlOldNewline:
+				row[i] += "\n" + cell
+			case isWrapMarker(above[i]) || left[i] == psqlOldWrap:
+				row[i] += cell
+			}
+		}
+
+		above = right
+	}
+
+	return row
+}
+
+func parseRow(layout []cellSpan, str string) []string {
+	row := splitRow(layout, str)
+
+	for i := range row {
 		row[i] = strings.TrimSpace(row[i])
+	}
+
+	return row
+}
+
+// Cut the row up into columns, leaving the padding in place.
+func splitRow(layout []cellSpan, str string) []string {
+	row := make([]string, len(layout))
+	display := newDisplayLine(str)
 
-		offset += col.Width + 3
+	for i, span := range layout {
+		row[i] = display.slice(span.start, span.start+span.width)
 	}
 
 	return row
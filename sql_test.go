@@ -0,0 +1,291 @@
+package vxsv
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContinuesRow(t *testing.T) {
+	// " colA | colB"
+	layout := []cellSpan{{1, 4}, {8, 4}}
+
+	tests := []struct {
+		line, next string
+		want       bool
+	}{
+		{" foo  | bar", " baz  | qux", false},
+		{" foo +| bar", " baz  | ", true},
+		{" foo  | bar +", "      | baz", true},
+		{" foo .| bar", " baz  | ", true},
+		{" foo ↵│ bar", " baz  │ ", true},
+		{" foo …│ bar", " baz  │ ", true},
+		{" foo  | bar", " baz  : qux", true},
+		{" foo  | bar", " baz  ; qux", true},
+		{" a+b  | c.d", " e    | f", false},
+		{" 日本 | bar", " baz  | qux", false},
+		{" 日本+| bar", " baz  | ", true},
+	}
+
+	for _, test := range tests {
+		if got := continuesRow(layout, test.line, test.next); got != test.want {
+			t.Errorf("continuesRow(%q, %q) = %v, want %v", test.line, test.next, got, test.want)
+		}
+	}
+}
+
+func TestParseLayout(t *testing.T) {
+	tests := []struct {
+		separator string
+		want      []cellSpan
+	}{
+		{"------+------", []cellSpan{{1, 4}, {8, 4}}},
+		{"+----+------+", []cellSpan{{2, 2}, {7, 4}}},
+		{"─────┼───", []cellSpan{{1, 3}, {7, 1}}},
+		{"┌────┬──┐", []cellSpan{{2, 2}, {7, 0}}},
+		{"---- ------", []cellSpan{{0, 4}, {5, 6}}},
+		{"-----", []cellSpan{{1, 3}}},
+		{"-", []cellSpan{{1, 0}}},
+		{"foo | bar", []cellSpan{}},
+		{"", []cellSpan{}},
+	}
+
+	for _, test := range tests {
+		if got := parseLayout(test.separator); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseLayout(%q) = %v, want %v", test.separator, got, test.want)
+		}
+	}
+}
+
+type readTable struct {
+	names []string
+	rows  [][]string
+}
+
+// Every table of a source, waiting for them all to load
+func readTables(t *testing.T, source RowSource) ([]readTable, []string) {
+	t.Helper()
+
+	readSource(t, source)
+
+	set, ok := source.(*TableSet)
+	if !ok {
+		names, rows := readSource(t, source)
+		return []readTable{{names, rows}}, nil
+	}
+
+	tables := []readTable{}
+	for i := 0; i < set.Count(); i++ {
+		names, rows := readSource(t, set.Table(i))
+		tables = append(tables, readTable{names, rows})
+	}
+
+	return tables, set.Messages()
+}
+
+func TestReadPSQLTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		tables   []readTable
+		messages []string
+	}{
+		{
+			"aligned",
+			" id | name\n----+------\n  1 | foo\n  2 | \n(2 rows)\n\n",
+			[]readTable{{[]string{"id", "name"}, [][]string{{"1", "foo"}, {"2", ""}}}},
+			[]string{},
+		},
+		{
+			"border 0 with a value in parentheses",
+			"a   b\n--- ---\n1   2\n(x) 1\n2   3\n(3 rows)\n\n",
+			[]readTable{{[]string{"a", "b"}, [][]string{{"1", "2"}, {"(x)", "1"}, {"2", "3"}}}},
+			[]string{},
+		},
+		{
+			"border 2",
+			"+----+-----+\n| id | v   |\n+----+-----+\n|  1 | (a) |\n+----+-----+\n(1 row)\n\n",
+			[]readTable{{[]string{"id", "v"}, [][]string{{"1", "(a)"}}}},
+			[]string{},
+		},
+		{
+			"several result sets and messages",
+			"SET\nNOTICE:  hello\n a\n---\n 1\n(1 row)\n\nINSERT 0 1\n b | c\n---+---\n(0 rows)\n\n",
+			[]readTable{
+				{[]string{"a"}, [][]string{{"1"}}},
+				{[]string{"b", "c"}, [][]string{}},
+			},
+			[]string{"SET", "NOTICE:  hello", "INSERT 0 1"},
+		},
+		{
+			"without a footer",
+			" a | b\n---+---\n 1 | 2\n",
+			[]readTable{{[]string{"a", "b"}, [][]string{{"1", "2"}}}},
+			[]string{},
+		},
+	}
+
+	for _, test := range tests {
+		source, err := ReadPSQLTable(strings.NewReader(test.input), "", 100)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		tables, messages := readTables(t, source)
+		if !reflect.DeepEqual(tables, test.tables) || !reflect.DeepEqual(messages, test.messages) {
+			t.Errorf("%s: read %q %q, want %q %q", test.name, tables, messages, test.tables, test.messages)
+		}
+	}
+}
+
+func TestReadPSQLTableNull(t *testing.T) {
+	source, err := ReadPSQLTable(strings.NewReader(" a | b\n---+---\n ∅ | \n(1 row)\n"), "∅", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, rows := readSource(t, source); !reflect.DeepEqual(rows, [][]string{{Null, ""}}) {
+		t.Errorf("read %q, want a NULL and an empty string", rows)
+	}
+}
+
+func TestIsRowCount(t *testing.T) {
+	tests := map[string]bool{
+		"(1 row)":     true,
+		"(12 rows)":   true,
+		"(0 rows)":    true,
+		"(x) 1":       false,
+		"(a) (b)":     false,
+		"(some rows)": false,
+		"(1 rows) x":  false,
+		"":            false,
+	}
+
+	for line, want := range tests {
+		if got := isRowCount(line); got != want {
+			t.Errorf("isRowCount(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestReadPSQLExpanded(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  readTable
+	}{
+		{
+			"records",
+			"-[ RECORD 1 ]-\nid   | 1\nname | foo\n-[ RECORD 2 ]-\nid   | 2\nname | \n\n",
+			readTable{[]string{"id", "name"}, [][]string{{"1", "foo"}, {"2", ""}}},
+		},
+		{
+			"row count footer",
+			"-[ RECORD 1 ]\na | (x)\n(1 row)\n\n",
+			readTable{[]string{"a"}, [][]string{{"(x)"}}},
+		},
+		{
+			"multi-line values",
+			"-[ RECORD 1 ]----\nid   | 1\nnote | one     +\n     |   two\nname | a\n",
+			readTable{[]string{"id", "note", "name"}, [][]string{{"1", "one\n  two", "a"}}},
+		},
+		{
+			"unicode line style",
+			"─[ RECORD 1 ]─\nid   │ 1\nname │ foo\n",
+			readTable{[]string{"id", "name"}, [][]string{{"1", "foo"}}},
+		},
+		{
+			"unicode multi-line values",
+			"─[ RECORD 1 ]─\nnote │ one↵\n     │ two\n",
+			readTable{[]string{"note"}, [][]string{{"one\ntwo"}}},
+		},
+		{
+			"border 2",
+			"┌─[ RECORD 1 ]─┐\n│ id   │ 1     │\n│ name │ foo   │\n└──────┴───────┘\n",
+			readTable{[]string{"id", "name"}, [][]string{{"1", "foo"}}},
+		},
+	}
+
+	for _, test := range tests {
+		source, err := ReadPSQLTable(strings.NewReader(test.input), "", 100)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		tables, _ := readTables(t, source)
+		if !reflect.DeepEqual(tables, []readTable{test.want}) {
+			t.Errorf("%s: read %q, want %q", test.name, tables, test.want)
+		}
+	}
+}
+
+func TestReadMySQLVertical(t *testing.T) {
+	header := func(n int) string {
+		return fmt.Sprintf("*************************** %d. row ***************************\n", n)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  readTable
+	}{
+		{
+			"records",
+			header(1) + "  id: 1\nname: foo\n" + header(2) + "  id: 2\nname: NULL\n2 rows in set (0.00 sec)\n\n",
+			readTable{[]string{"id", "name"}, [][]string{{"1", "foo"}, {"2", Null}}},
+		},
+		{
+			"blank lines within a value",
+			header(1) + "  id: 1\nbody: one\n\ntwo\n\n" + header(2) + "  id: 2\nbody: \n1 row in set (0.00 sec)\n",
+			readTable{[]string{"id", "body"}, [][]string{{"1", "one\n\ntwo\n"}, {"2", ""}}},
+		},
+		{
+			"values that look like fields",
+			header(1) + "  id: 1\nbody: a\nid: 2\n" + header(2) + "  id: 3\nbody: b\n",
+			readTable{[]string{"id", "body"}, [][]string{{"1", "a\nid: 2"}, {"3", "b"}}},
+		},
+		{
+			"names that aren't ascii, padded by width",
+			header(1) + "prénom: Zoé\n   nom: Ünal\n",
+			readTable{[]string{"prénom", "nom"}, [][]string{{"Zoé", "Ünal"}}},
+		},
+		{
+			"names that aren't ascii, padded by bytes",
+			header(1) + "prénom: Zoé\n    nom: Ünal\n",
+			readTable{[]string{"prénom", "nom"}, [][]string{{"Zoé", "Ünal"}}},
+		},
+	}
+
+	for _, test := range tests {
+		source, err := ReadMySQLTable(strings.NewReader(test.input), "NULL", 100)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		names, rows := readSource(t, source)
+		if got := (readTable{names, rows}); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: read %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsMySQLFooter(t *testing.T) {
+	tests := map[string]bool{
+		"1 row in set (0.00 sec)":             true,
+		"2 rows in set, 1 warning (0.01 sec)": true,
+		"Empty set (0.00 sec)":                true,
+		"":                                    false,
+		"name: 3 rows in set":                 false,
+		"*************************** 1. row ****": false,
+	}
+
+	for line, want := range tests {
+		if got := isMySQLFooter(line); got != want {
+			t.Errorf("isMySQLFooter(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
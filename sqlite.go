@@ -0,0 +1,188 @@
+// Reading tables straight out of SQLite database files.
+
+package vxsv
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Every SQLite database file starts with this
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// A table or view of a database
+type DatabaseTable struct {
+	Name string
+	Type string // "table" or "view"
+}
+
+// Description for the mode line, e.g. sqlite table "users"
+func (t DatabaseTable) String() string {
+	return fmt.Sprintf("sqlite %s \"%s\"", t.Type, t.Name)
+}
+
+// Database is an SQLite database opened read only, see OpenSQLite.
+type Database struct {
+	db    *sql.DB
+	count int64 // Maximum number of rows loaded by Query
+}
+
+// Open the database at path without changing it. At most count rows are
+// loaded by each query.
+func OpenSQLite(path string, count int64) (*Database, error) {
+	uri := url.URL{Scheme: "file", Opaque: (&url.URL{Path: path}).EscapedPath(), RawQuery: "mode=ro"}
+
+	db, err := sql.Open("sqlite3", uri.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Database{db: db, count: count}, nil
+}
+
+// The tables and views of the database, leaving out SQLite's own.
+func (d *Database) Tables() ([]DatabaseTable, error) {
+	rows, err := d.db.Query(`SELECT name, type FROM sqlite_master
+		WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []DatabaseTable{}
+
+	for rows.Next() {
+		var table DatabaseTable
+		if err := rows.Scan(&table.Name, &table.Type); err != nil {
+			return nil, err
+		}
+
+		tables = append(tables, table)
+	}
+
+	return tables, rows.Err()
+}
+
+// Load every row of a table or view.
+func (d *Database) Table(name string) (RowSource, error) {
+	return d.Query("SELECT * FROM " + quoteSQLIdentifier(name))
+}
+
+// Run a query, loading its rows in the background. Columns have the type
+// they were declared with, if any, and NULL values are read as Null.
+func (d *Database) Query(query string) (RowSource, error) {
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+
+	columns := make([]Column, len(types))
+	for i, t := range types {
+		columns[i] = Column{Name: t.Name(), Type: t.DatabaseTypeName(), Width: displayWidth(t.Name())}
+	}
+
+	// Rows are kept in memory, there's no text to go back to
+	source := newStreamSource(nil, nil)
+	source.begin(columns, 0)
+
+	records := &sqliteRecords{rows: rows, values: make([]interface{}, len(columns))}
+
+	go func() {
+		source.load(records, d.count)
+		rows.Close()
+	}()
+
+	return source, nil
+}
+
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+type sqliteRecords struct {
+	rows   *sql.Rows
+	values []interface{}
+}
+
+func (r *sqliteRecords) Read() ([]string, int64, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		return nil, 0, io.EOF
+	}
+
+	dest := make([]interface{}, len(r.values))
+	for i := range r.values {
+		dest[i] = &r.values[i]
+	}
+
+	if err := r.rows.Scan(dest...); err != nil {
+		return nil, 0, err
+	}
+
+	record := make([]string, len(r.values))
+	for i, value := range r.values {
+		record[i] = sqliteText(value)
+	}
+
+	return record, 0, nil
+}
+
+// The text shown for a value. Blobs that aren't text are shown as hex
+// literals, e.g. x'89504e47'.
+func sqliteText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return Null
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return escapeNul(v)
+	case []byte:
+		if utf8.Valid(v) {
+			return escapeNul(string(v))
+		}
+
+		return "x'" + hex.EncodeToString(v) + "'"
+	case time.Time:
+		// Columns declared as dates come back parsed, print them the way
+		// SQLite's date functions do
+		if v.Location() == time.UTC {
+			if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+				return v.Format("2006-01-02")
+			}
+
+			return v.Format("2006-01-02 15:04:05.999999999")
+		}
+
+		return v.Format("2006-01-02 15:04:05.999999999-07:00")
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,110 @@
+package vxsv
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testDatabase(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, stmt := range []string{
+		`CREATE TABLE "odd ""name""" (id INTEGER, name TEXT, score REAL, data BLOB, born DATE)`,
+		`INSERT INTO "odd ""name""" VALUES (1, 'foo', 1.5, x'89504e47', '2024-03-05')`,
+		`INSERT INTO "odd ""name""" VALUES (2, '', NULL, CAST('text' AS BLOB), NULL)`,
+		`INSERT INTO "odd ""name""" VALUES (3, 'a' || char(0) || 'b', 2, NULL, '2024-03-05 10:20:30')`,
+		`CREATE VIEW names AS SELECT name FROM "odd ""name"""`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return path
+}
+
+func TestSQLite(t *testing.T) {
+	db, err := OpenSQLite(testDatabase(t), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tables, err := db.Tables()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantTables := []DatabaseTable{{"names", "view"}, {`odd "name"`, "table"}}
+	if !reflect.DeepEqual(tables, wantTables) {
+		t.Errorf("Tables() = %v, want %v", tables, wantTables)
+	}
+
+	source, err := db.Table(`odd "name"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, rows := readSource(t, source)
+
+	wantNames := []string{"id", "name", "score", "data", "born"}
+	wantRows := [][]string{
+		{"1", "foo", "1.5", "x'89504e47'", "2024-03-05"},
+		{"2", "", Null, "text", Null},
+		{"3", "a␀b", "2", Null, "2024-03-05 10:20:30"},
+	}
+
+	if !reflect.DeepEqual(names, wantNames) || !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("read %q %q, want %q %q", names, rows, wantNames, wantRows)
+	}
+
+	if types := []string{source.Header()[0].Type, source.Header()[1].Type}; !reflect.DeepEqual(types, []string{"INTEGER", "TEXT"}) {
+		t.Errorf("column types %q, want INTEGER and TEXT", types)
+	}
+}
+
+func TestSQLiteQuery(t *testing.T) {
+	db, err := OpenSQLite(testDatabase(t), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	source, err := db.Query("SELECT id, id * 2 AS double FROM \"odd \"\"name\"\"\" ORDER BY id DESC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// At most count rows
+	names, rows := readSource(t, source)
+	if want := [][]string{{"3", "6"}, {"2", "4"}}; !reflect.DeepEqual(names, []string{"id", "double"}) || !reflect.DeepEqual(rows, want) {
+		t.Errorf("read %q %q, want id, double and %q", names, rows, want)
+	}
+
+	if _, err := db.Query("SELECT nope FROM names"); err == nil {
+		t.Error("query of a missing column succeeded")
+	}
+
+	// Opened read only, which only fails once the rows are loaded
+	source, err = db.Query(`DELETE FROM "odd ""name"""`)
+	if err == nil {
+		for !source.Done() {
+			time.Sleep(time.Millisecond)
+		}
+
+		err = source.Err()
+	}
+
+	if err == nil {
+		t.Error("query changing the database succeeded")
+	}
+}
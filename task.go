@@ -0,0 +1,70 @@
+// Long running operations that happen off the event loop.
+
+package vxsv
+
+import (
+	"sync/atomic"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Task tracks the progress of work running in a background goroutine.
+//
+// While a task is running the UI only redraws and waits for it, so the
+// work can safely read UI state. It must not modify it though; instead
+// the work returns a function that applies its result, which is called
+// from the event loop once the task finishes.
+type Task struct {
+	Name string
+
+	total     int64
+	progress  atomic.Int64
+	cancelled atomic.Bool
+	finished  atomic.Bool
+	apply     func()
+}
+
+func (t *Task) Step() {
+	t.progress.Add(1)
+}
+
+func (t *Task) Cancel() {
+	t.cancelled.Store(true)
+}
+
+func (t *Task) Cancelled() bool {
+	return t.cancelled.Load()
+}
+
+// Returns -1 if the amount of work is unknown
+func (t *Task) Percent() int {
+	if t.total <= 0 {
+		return -1
+	}
+
+	return clamp(int(100*t.progress.Load()/t.total), 0, 100)
+}
+
+// Run work in the background, showing its progress until it is done. The
+// returned function is skipped when the task is cancelled. In batch mode
+// the work runs right away instead.
+func (ui *UI) runTask(name string, total int, work func(t *Task) func()) {
+	task := &Task{Name: name, total: int64(total)}
+
+	// Nothing to draw, just do the work
+	if ui.batch {
+		if apply := work(task); apply != nil {
+			apply()
+		}
+		return
+	}
+
+	ui.pushHandler(&HandlerTask{HandlerDefault{ui}, task})
+
+	go func() {
+		task.apply = work(task)
+		task.finished.Store(true)
+
+		termbox.Interrupt()
+	}()
+}
@@ -5,24 +5,142 @@ package vxsv
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/mattn/go-runewidth"
 	"github.com/nsf/termbox-go"
+	"github.com/rivo/uniseg"
 )
 
+// What is drawn for one grapheme cluster (a character as the user sees
+// it, e.g. "e" followed by a combining accent, or a flag). termbox has no
+// way of combining runes, so only the first one is drawn, followed by
+// spaces when the whole cluster is wider than that rune.
+type glyph struct {
+	ch    rune
+	text  string
+	width int // Cells taken up on screen
+}
+
+// Cells taken up by a rune as termbox draws it, which is as a space for
+// control characters and as a single cell for zero width runes.
+func runeCells(r rune) int {
+	width := runewidth.RuneWidth(r)
+	if width == 0 || width == 2 && runewidth.IsAmbiguousWidth(r) {
+		return 1
+	}
+
+	return width
+}
+
+func glyphs(str string) []glyph {
+	result := []glyph{}
+
+	graphemes := uniseg.NewGraphemes(str)
+	for graphemes.Next() {
+		ch := graphemes.Runes()[0]
+
+		// Flags and emoji sequences are measured as a whole
+		width := runeCells(ch)
+		if clusterWidth := graphemes.Width(); clusterWidth > width {
+			width = clusterWidth
+		}
+
+		result = append(result, glyph{ch, graphemes.Str(), width})
+	}
+
+	return result
+}
+
+func isASCII(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if str[i] >= 0x80 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Number of cells str takes up on screen
+func displayWidth(str string) int {
+	if isASCII(str) {
+		return len(str)
+	}
+
+	width := 0
+	for _, g := range glyphs(str) {
+		width += g.width
+	}
+
+	return width
+}
+
+// Pad with spaces on the right to at least width cells
+func padRight(str string, width int) string {
+	if pad := width - displayWidth(str); pad > 0 {
+		return str + strings.Repeat(" ", pad)
+	}
+
+	return str
+}
+
+// Pad with spaces on the left to at least width cells
+func padLeft(str string, width int) string {
+	if pad := width - displayWidth(str); pad > 0 {
+		return strings.Repeat(" ", pad) + str
+	}
+
+	return str
+}
+
+// The part of str between the given cells, padded out to exactly width
+// cells. Wide characters cut in half by either end are replaced by spaces.
+func sliceCells(str string, start, width int) string {
+	var b strings.Builder
+	x, used := 0, 0
+
+	for _, g := range glyphs(str) {
+		if x < start && x+g.width > start {
+			// Keep the right half of a wide character in its place
+			b.WriteString(strings.Repeat(" ", x+g.width-start))
+			used += x + g.width - start
+		} else if x >= start && used+g.width <= width {
+			b.WriteString(g.text)
+			used += g.width
+		} else if x >= start {
+			break
+		}
+
+		x += g.width
+	}
+
+	return padRight(b.String(), width)
+}
+
+// Draw a glyph, filling any cells termbox won't draw into with spaces
+func setGlyph(x, y int, fg, bg termbox.Attribute, g glyph) {
+	termbox.SetCell(x, y, g.ch, fg, bg)
+
+	for i := runeCells(g.ch); i < g.width; i++ {
+		termbox.SetCell(x+i, y, ' ', fg, bg)
+	}
+}
+
 func writeStringBounded(x, y, bound int, fg, bg termbox.Attribute, msg string) int {
-	for _, c := range msg {
+	for _, g := range glyphs(msg) {
 		if x >= bound {
-			termbox.SetCell(x, y, c, fg, bg)
+			setGlyph(x, y, fg, bg, g)
 		}
-		x++
+		x += g.width
 	}
 	return x
 }
 
 func writeString(x, y int, fg, bg termbox.Attribute, msg string) int {
-	for _, c := range msg {
-		termbox.SetCell(x, y, c, fg, bg)
-		x++
+	for _, g := range glyphs(msg) {
+		setGlyph(x, y, fg, bg, g)
+		x += g.width
 	}
 	return x
 }
@@ -31,10 +149,7 @@ func writeString(x, y int, fg, bg termbox.Attribute, msg string) int {
 func writeLine(x, y int, fg, bg termbox.Attribute, line string) {
 	width, _ := termbox.Size()
 
-	for _, c := range line {
-		termbox.SetCell(x, y, c, fg, bg)
-		x++
-	}
+	x = writeString(x, y, fg, bg, line)
 	for i := x; i < width; i++ {
 		termbox.SetCell(x+i, y, ' ', fg, bg)
 	}
@@ -48,21 +163,13 @@ func (ui *UI) writeModeLine(mode string, left []string) {
 		termbox.SetCell(i, height-1, ' ', termbox.ColorDefault, termbox.ColorDefault)
 	}
 
-	var x int
-	for _, ch := range mode {
-		termbox.SetCell(x, height-1, ch, termbox.ColorDefault|termbox.AttrBold, termbox.ColorDefault)
-		x++
-	}
+	x := writeString(0, height-1, termbox.ColorDefault|termbox.AttrBold, termbox.ColorDefault, mode)
 
 	termbox.SetCell(x, height-1, ' ', termbox.ColorDefault, termbox.ColorDefault)
 	x++
 
 	for _, str := range left {
-		for _, ch := range str {
-			termbox.SetCell(x, height-1, ch, termbox.ColorDefault, termbox.ColorDefault)
-			x++
-		}
-
+		x = writeString(x, height-1, termbox.ColorDefault, termbox.ColorDefault, str)
 		x++
 	}
 
@@ -75,37 +182,92 @@ func (ui *UI) writeModeLine(mode string, left []string) {
 		filterString = fmt.Sprintf("filter:\"%s\" :: ", ui.filter.String())
 	}
 
-	right := fmt.Sprintf("%srows %d-%d of %d", filterString, first, last, total)
-	x = len(right)
-	for _, ch := range right {
-		termbox.SetCell(width-x, height-1, ch, termbox.ColorGreen|termbox.AttrBold, termbox.ColorDefault)
-		x--
+	loading := ""
+	if !ui.input.Done() {
+		loading = " (loading...)"
+
+		if source, ok := ui.input.(progressReporter); ok {
+			if done, total := source.Progress(); total > 0 {
+				loading = fmt.Sprintf(" (loading %d%%)", 100*done/total)
+			}
+		}
+	}
+
+	if problems := SourceProblems(ui.source); len(problems) > 0 {
+		filterString = fmt.Sprintf("%d bad rows (P) :: %s", len(problems), filterString)
+	}
+
+	if ui.tables != nil && ui.tables.Count() > 1 {
+		table := fmt.Sprintf("result %d of %d", ui.tableIdx+1, ui.tables.Count())
+		if name := ui.tables.Name(ui.tableIdx); name != "" {
+			table = fmt.Sprintf("sheet \"%s\" (%d of %d)", name, ui.tableIdx+1, ui.tables.Count())
+		}
+
+		filterString = table + " :: " + filterString
 	}
+
+	if ui.format != "" {
+		filterString = ui.format + " :: " + filterString
+	}
+
+	right := fmt.Sprintf("%srows %d-%d of %d%s", filterString, first, last, total, loading)
+	writeString(width-displayWidth(right), height-1, termbox.ColorGreen|termbox.AttrBold, termbox.ColorDefault, right)
+}
+
+// What is drawn for a cell, before it's fitted to the column
+func cellText(cell string) string {
+	if cell == Null {
+		return NullText
+	}
+
+	return strings.Replace(cell, "\n", NewlineGlyph, -1)
+}
+
+// Pad or truncate to exactly width cells, marking anything cut off with …
+func fitCell(str string, width int) string {
+	if width <= 0 {
+		return ""
+	} else if displayWidth(str) <= width {
+		return padRight(str, width)
+	}
+
+	return sliceCells(str, 0, width-1) + "…"
 }
 
 func (ui *UI) writeCell(cell string, x, y, index, pinBound int, fg, bg termbox.Attribute) int {
 	col := ui.columns[index]
 
+	if cell == Null {
+		fg = NullFg
+	}
+
 	if col.Highlight {
 		fg = HiliteFg
 		bg = HiliteBg
 	}
 
-	formatted := cell
+	// Row 0 is the header, the rest are offset by the scroll position
+	if search := ui.search; search != nil && y > 0 && search.Matches(cell) {
+		if search.isCurrent(ui.offsetY+y-1, index) {
+			fg, bg = CurrentMatchFg, CurrentMatchBg
+		} else {
+			fg, bg = SearchFg, SearchBg
+		}
+	}
+
+	if cursor := ui.cursor; cursor != nil && y > 0 && *cursor == (cellRef{ui.offsetY + y - 1, index}) {
+		fg, bg = CursorFg, CursorBg
+	}
+
+	formatted := cellText(cell)
 
 	switch col.Display {
 	case ColumnDefault:
-		width := clamp(col.Width, 0, MaxCellWidth)
-
-		if len(formatted) > width {
-			formatted = fmt.Sprintf("%-*s…", width-1, formatted[:width-1])
-		} else {
-			formatted = fmt.Sprintf("%-*s", width, formatted)
-		}
+		formatted = fitCell(formatted, clamp(col.Width, 0, MaxCellWidth))
+	case ColumnResized:
+		formatted = fitCell(formatted, col.ResizedWidth)
 	case ColumnExpanded:
-		if len(formatted) < col.Width {
-			formatted = fmt.Sprintf("%-*s", col.Width, formatted)
-		}
+		formatted = padRight(formatted, col.Width)
 	case ColumnCollapsed:
 		formatted = "…"
 	case ColumnAligned:
@@ -114,7 +276,7 @@ func (ui *UI) writeCell(cell string, x, y, index, pinBound int, fg, bg termbox.A
 		if val, err := strconv.ParseFloat(cell, 64); err == nil {
 			formatted = fmt.Sprintf("%*.4f", width, val)
 		} else {
-			formatted = fmt.Sprintf("%*s", width, formatted)
+			formatted = padLeft(formatted, width)
 		}
 	}
 
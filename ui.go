@@ -2,6 +2,12 @@ package vxsv
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/nsf/termbox-go"
 )
@@ -10,9 +16,29 @@ const MaxCellWidth = 20
 const CellSeparator = " │ "
 const RowIndicator = '»'
 
+// Shown in place of newlines within a cell
+const NewlineGlyph = "↵"
+
+// Shown in place of Null cells
+const NullText = "NULL"
+const NullFg = termbox.ColorDefault | termbox.AttrDim
+
 const HiliteFg = termbox.ColorBlack | termbox.AttrBold
 const HiliteBg = termbox.ColorWhite
 
+const SearchFg = termbox.ColorBlack
+const SearchBg = termbox.ColorYellow
+const CurrentMatchFg = termbox.ColorBlack | termbox.AttrBold
+const CurrentMatchBg = termbox.ColorRed
+const CursorFg = termbox.ColorBlack | termbox.AttrBold
+const CursorBg = termbox.ColorCyan
+
+// On screen width of CellSeparator
+var SeparatorWidth = utf8.RuneCountInString(CellSeparator)
+
+// How often to check for newly loaded rows
+const LoadRefreshInterval = 100 * time.Millisecond
+
 const HelpText = `Key Bindings:
 
 vxsv is a modal viewer, meaning that actions are only valid in certain
@@ -22,14 +48,24 @@ DEFAULT MODE
 ============
 
   Ctrl l          refresh screen
+  Ctrl g          stop loading any remaining rows
   Ctrl a          pan to beginning of line
   Ctrl e          pan to end of line
   <arrow keys>    scroll / pan control
   Ctrl r, /       enter ** FILTER MODE **
+  Ctrl f, f       enter ** SEARCH MODE **
+  :               enter a command, see ** COMMANDS **
+  n, N            jump to next / previous search match
+  [, ]            switch to previous / next result set or sheet
+  M               show messages printed between result sets
+  P               list rows that didn't match the header (--lenient)
+  T               pick a table or view of an SQLite database to show
+  [ESC]           clear search highlighting
   [ENTER]         pop open dialog showing row in detail
   [SPACE]         scroll down one screen
   C               enter ** COLUMN SELECT MODE **
   R               enter ** ROW SELECT MODE **
+  V               enter ** CELL SELECT MODE **
   G               scroll to bottom
   g               scroll to top
   Z               toggle zebra stripes
@@ -37,6 +73,19 @@ DEFAULT MODE
   ?               show this help dialog
   Ctrl c          exit
 
+  Filtering, sorting and other slow operations run in the background with
+  their progress shown at the bottom of the screen, press [ESC] or Ctrl g
+  to cancel them.
+
+  Output of a psql script running several queries is split up into one
+  result set per query, with the number of the current one shown at the
+  bottom of the screen. Notices and other messages pop up once
+  everything has loaded.
+
+  The mouse wheel scrolls, clicking a cell enters ** CELL SELECT MODE **
+  on it, clicking a column name sorts by that column (click again to
+  reverse) and dragging the separator between two columns resizes them.
+
 COLUMN SELECT MODE
 ==================
 
@@ -57,29 +106,84 @@ COLUMN SELECT MODE
 FILTER MODE
 ===========
 
-  Filter expressions can take two forms:
+  Filter expressions are built from two forms:
 
     1. Column filter: "column_name CMP value"
        * CMP is one of (==, !=, <, <=, >, >=, ~, !~)
        * Display rows where the given column's value for the
          row makes the comparison evaluate to true.
        * Read '~' and '!~' as "matches" and "doesn't match",
-         respectively.
+         respectively. The value is a regular expression, which can
+         also be written as /pattern/i to ignore case. It runs up to
+         the next "and" or "or" outside of its own parentheses, so
+         path ~ ^/(api|admin)/ works without quoting.
 
     2. Row filter: "filter_string"
        * Display rows where any column in the row matches the
          filter string.
 
+  NULL values (from psql or mysql output) are only matched by
+  "column_name is null" and "column_name is not null", any other
+  comparison with them is false.
+  NUL characters in the input are shown as ␀, and are not NULL.
+
+  Both can be combined with "and", "or" and "not" (or "&&", "||" and "!"),
+  grouped with parentheses, for example:
+
+    status == 500 and (latency > 200 or not path ~ health)
+
+  Use double quotes around values containing any of these words or
+  characters, e.g. title == "rock and roll".
+
   [ESC], Ctrl g   clear filter and return to previous mode
   Ctrl w, Ctrl u  clear entered filter expression
   [ENTER]         apply filter and return to previous mode
 
+SEARCH MODE
+===========
+
+  Highlights every cell containing the search text (ignoring case) and
+  jumps between them, without hiding any rows. Write the search as
+  /pattern/ to use a regular expression instead, adding an "i" after the
+  last slash to ignore case.
+
+  [ESC], Ctrl g   clear search and return to previous mode
+  Ctrl w, Ctrl u  clear entered search
+  [ENTER]         jump to the first match on screen or after it
+
 ROW SELECT MODE
 ===============
 
   <arrow keys>    select row
   [ENTER]         pop open expanded row dialog.
 
+CELL SELECT MODE
+================
+
+  Moves a cursor between individual cells, showing the full value of the
+  current one at the bottom of the screen. Any of the COLUMN SELECT MODE
+  actions (sorting, pinning, etc.) apply to the column of the cursor.
+
+  <arrow keys>    move cursor
+  Ctrl a, Ctrl e  move to first / last column
+  g, G            move to first / last row
+  [SPACE]         move down one screen
+  [ENTER]         pop open dialog showing the cell's value
+  o               pop open dialog showing the cell's row in detail
+  y               copy the cell's value to the clipboard
+  [ESC], Ctrl g   return to ** DEFAULT MODE **
+
+COMMANDS
+========
+
+  :w PATH [FORMAT]   write the rows currently displayed (filtered, sorted
+                     and transformed) to PATH, leaving out collapsed
+                     columns. FORMAT is one of csv, tsv, jsonl, markdown
+                     or sql, guessed from the file extension by default.
+  :w! PATH [FORMAT]  same, replacing PATH if it already exists
+  :query SQL         run a query on the SQLite database being viewed and
+                     show its result instead
+
 SHELL COMMAND MODE
 ==================
   Pipe selected column's values into an external process, setting the new value
@@ -102,14 +206,38 @@ type UI struct {
 	offsetX, offsetY int // Pan control
 	filter           Filter
 	filterMatches    []int
+	search           *Search
+	cursor           *cellRef // Only set in cell select mode
+	batch            bool     // No terminal, see RunBatch
+
+	dragColumn       int // Column being resized with the mouse, or -1
+	dragX, dragWidth int // Where the drag started
 	zebraStripe      bool
 	allExpanded      bool
 	columns          []Column
-	rows             [][]string
+
+	input        RowSource // What the UI was started with
+	format       string    // How input was read, for the mode line
+	tables       *TableSet // Only set when input holds several tables
+	database     *Database // Only set when input is an SQLite database
+	tableIdx     int
+	source       RowSource // The table being displayed
+	loaded       int       // Number of rows pulled from source so far
+	feed         *rowFeed  // Rows after loaded being read, see syncSource
+	loadReported bool      // Whether a load error has been shown
+	messagesSeen bool      // Whether messages have been shown, see TableSet
+
+	sortColumn  int // -1 when unsorted
+	sortReverse bool
+	sortKeys    []string // Value of sortColumn for each loaded row
+
+	uniqueColumn int                 // Only the first row with each value is shown, or -1
+	uniqueSeen   map[string]struct{} // Values of uniqueColumn shown so far
 }
 
 type Column struct {
 	Name string
+	Type string // Declared type, only known for databases
 
 	// Display options
 	Display   ColumnDisplay
@@ -117,6 +245,8 @@ type Column struct {
 	Highlight bool
 	Width     int
 
+	ResizedWidth int // Only for ColumnResized
+
 	Modified        bool
 	ModifiedValues  []string
 	ModifiedCommand string
@@ -136,6 +266,9 @@ const (
 
 	// TODO: Move this to the Modified attribute
 	ColumnAligned
+
+	// Width set by dragging the separator with the mouse
+	ColumnResized
 )
 
 func (c *Column) toggleDisplay(mode ColumnDisplay) {
@@ -156,6 +289,8 @@ func (c Column) displayWidth() int {
 		return c.Width
 	case ColumnDefault:
 		return clamp(c.Width, 1, MaxCellWidth)
+	case ColumnResized:
+		return c.ResizedWidth
 	}
 
 	panic("TODO: this is a bug")
@@ -171,39 +306,197 @@ func clamp(val, lo, hi int) int {
 
 	return val
 }
-func NewUI(data *TabularData) *UI {
-	filterMatches := make([]int, len(data.Rows))
+func NewUI(source RowSource) *UI {
+	ui := &UI{
+		input:       source,
+		zebraStripe: false,
+		dragColumn:  -1,
+	}
+
+	if tables, ok := source.(*TableSet); ok {
+		ui.tables = tables
+		source = tables.Table(0)
+	}
+
+	ui.showTable(source)
+
+	return ui
+}
 
-	for i, col := range data.Columns {
+// Describe how the input was read in the mode line, e.g. "csv (;)"
+func (ui *UI) SetFormat(format string) {
+	ui.format = format
+}
+
+// Start over with a fresh view of the given table
+func (ui *UI) showTable(source RowSource) {
+	columns := source.Header()
+
+	for i, col := range columns {
 		col.Display = ColumnDefault
 		col.Pinned = false
 		col.Highlight = false
 		col.Modified = false
 
 		// Last column should open expanded
-		if i == len(data.Columns)-1 {
+		if i == len(columns)-1 {
 			col.Display = ColumnExpanded
 		}
 	}
 
-	for i := range data.Rows {
-		filterMatches[i] = i
+	ui.source = source
+	ui.columns = columns
+	ui.loaded = 0
+	ui.rowIdx = 0
+	ui.offsetX = 0
+	ui.offsetY = 0
+	ui.allExpanded = false
+	ui.filter = EmptyFilter{}
+	ui.filterMatches = []int{}
+	ui.search = nil
+	ui.cursor = nil
+	ui.sortColumn = -1
+	ui.sortKeys = nil
+	ui.uniqueColumn = -1
+	ui.uniqueSeen = nil
+	ui.stopFeed()
+
+	ui.switchToDefault()
+	ui.syncSource()
+}
+
+// Move to the previous (-1) or next (1) table, when there are several
+func (ui *UI) switchTable(direction int) {
+	if ui.tables == nil {
+		return
 	}
 
-	ui := &UI{
-		offsetX:       0,
-		offsetY:       0,
-		rows:          data.Rows,
-		columns:       data.Columns,
-		zebraStripe:   false,
-		allExpanded:   false,
-		filter:        EmptyFilter{},
-		filterMatches: filterMatches,
+	idx := ui.tableIdx + direction
+	if idx < 0 || idx >= ui.tables.Count() {
+		return
 	}
 
-	ui.switchToDefault()
+	ui.tableIdx = idx
+	ui.showTable(ui.tables.Table(idx))
+}
 
-	return ui
+// Shows anything printed between the tables, e.g. NOTICE: ...
+func (ui *UI) showMessages() {
+	if ui.tables == nil {
+		return
+	}
+
+	messages := ui.tables.Messages()
+	if len(messages) == 0 {
+		messages = []string{"No messages"}
+	}
+
+	ui.messagesSeen = true
+	ui.pushHandler(NewPopup(ui, strings.Join(messages, "\n")))
+}
+
+// Lists rows that didn't match the header, see ReadCSVFile
+func (ui *UI) showProblems() {
+	problems := SourceProblems(ui.source)
+	if len(problems) == 0 {
+		ui.pushHandler(NewPopup(ui, "No problems reading the input"))
+		return
+	}
+
+	items := make([]string, len(problems))
+	for i, problem := range problems {
+		items[i] = fmt.Sprintf("line %d: %s", problem.Line, problem.Message)
+	}
+
+	ui.pushHandler(NewListPopup(ui, "Problems", "([ENTER] to jump to row)", items, func(idx int) {
+		ui.jumpToRow(problems[idx].Row)
+	}))
+}
+
+// Let other tables of a database be picked, see ShowTablePicker
+func (ui *UI) SetDatabase(db *Database) {
+	ui.database = db
+}
+
+// Lists the tables and views of the database, [ENTER] loads one
+func (ui *UI) ShowTablePicker() {
+	if ui.database == nil {
+		ui.pushHandler(NewPopup(ui, "Only SQLite databases have tables to pick from"))
+		return
+	}
+
+	tables, err := ui.database.Tables()
+	if err != nil {
+		ui.pushErrorPopup("Failed to list tables", err)
+		return
+	} else if len(tables) == 0 {
+		ui.pushHandler(NewPopup(ui, "No tables in the database"))
+		return
+	}
+
+	items := make([]string, len(tables))
+	for i, table := range tables {
+		items[i] = table.Name
+		if table.Type != "table" {
+			items[i] += " (" + table.Type + ")"
+		}
+	}
+
+	ui.pushHandler(NewListPopup(ui, "Tables", "([ENTER] to load table)", items, func(idx int) {
+		source, err := ui.database.Table(tables[idx].Name)
+		if err != nil {
+			ui.pushErrorPopup("Failed to load "+tables[idx].Name, err)
+			return
+		}
+
+		ui.format = tables[idx].String()
+		ui.showInput(source)
+	}))
+}
+
+// Replace what's displayed with the result of a query on the database
+func (ui *UI) runQuery(query string) error {
+	if ui.database == nil {
+		return fmt.Errorf("Only SQLite databases can be queried")
+	}
+
+	source, err := ui.database.Query(query)
+	if err != nil {
+		return err
+	}
+
+	ui.format = "sqlite query"
+	ui.showInput(source)
+	return nil
+}
+
+// Start over with different input, stopping whatever is still loading
+func (ui *UI) showInput(source RowSource) {
+	if input, ok := ui.input.(cancelable); ok {
+		input.Cancel()
+	}
+
+	ui.input = source
+	ui.tables = nil
+	ui.tableIdx = 0
+	ui.loadReported = false
+
+	ui.showTable(source)
+	go ui.watchSource(source)
+}
+
+// Put the cursor on a row, given its index in the source
+func (ui *UI) jumpToRow(idx int) {
+	for pos, match := range ui.filterMatches {
+		if match == idx {
+			cellSelect := NewCellSelect(ui)
+			ui.pushHandler(cellSelect)
+			cellSelect.moveTo(pos, ui.findFirstColumn())
+			return
+		}
+	}
+
+	ui.pushHandler(NewPopup(ui, "That row is hidden by the current filter"))
 }
 
 func (ui *UI) Init() error {
@@ -211,13 +504,14 @@ func (ui *UI) Init() error {
 		return err
 	}
 
-	termbox.SetInputMode(termbox.InputEsc)
+	termbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
 	return nil
 }
 
 func (ui *UI) Loop() {
 	defer termbox.Close()
 
+	go ui.watchSource(ui.input)
 	ui.repaint()
 
 eventloop:
@@ -229,23 +523,304 @@ eventloop:
 			}
 
 			ui.activeHandler().HandleKey(ev)
+		case termbox.EventMouse:
+			ui.handleMouse(ev)
+		case termbox.EventResize:
+			ui.resize()
+		case termbox.EventInterrupt:
+			if h, ok := ui.activeHandler().(*HandlerTask); ok {
+				h.poll()
+			} else {
+				ui.syncSource()
+			}
 		}
 
 		ui.repaint()
 	}
 }
 
-// Return indices of rows to display
-func (ui *UI) filterRows() {
-	rows := make([]int, 0, 100)
+// Wake up the event loop every so often while rows are still loading, so
+// that they get displayed.
+func (ui *UI) watchSource(input RowSource) {
+	for !input.Done() {
+		time.Sleep(LoadRefreshInterval)
+		termbox.Interrupt()
+	}
+
+	termbox.Interrupt()
+}
+
+// Pull in any rows that have loaded since the last call, keeping the
+// current filter and sort order.
+func (ui *UI) syncSource() {
+	total := ui.source.Len()
+	header := ui.source.Header()
+
+	for i := range ui.columns {
+		if !ui.columns[i].Modified && header[i].Width > ui.columns[i].Width {
+			ui.columns[i].Width = header[i].Width
+		}
+	}
+
+	// Some sources find more columns as they go, e.g. JSON
+	ui.columns = append(ui.columns, header[len(ui.columns):]...)
+
+	if feed := ui.feed; feed != nil && feed.done.Load() {
+		ui.feed = nil
+		ui.addRows(feed)
+	}
+
+	if total > ui.loaded && ui.feed == nil {
+		feed := &rowFeed{first: ui.loaded, end: total}
+		_, unfiltered := ui.filter.(EmptyFilter)
+
+		switch {
+		case unfiltered && ui.sortColumn < 0 && ui.uniqueColumn < 0:
+			// Nothing needs to be read
+			for i := feed.first; i < feed.end; i++ {
+				feed.matches = append(feed.matches, i)
+			}
+
+			ui.addRows(feed)
+		case ui.batch:
+			feed.read(ui.source, ui.filter, ui.sortColumn, ui.uniqueColumn)
+			ui.addRows(feed)
+		default:
+			ui.feed = feed
+			go func(source RowSource, filter Filter, sortColumn, uniqueColumn int) {
+				feed.read(source, filter, sortColumn, uniqueColumn)
+				termbox.Interrupt()
+			}(ui.source, ui.filter, ui.sortColumn, ui.uniqueColumn)
+		}
+	}
+
+	if ui.source.Done() && ui.source.Err() != nil && !ui.loadReported {
+		ui.loadReported = true
+		ui.pushErrorPopup("Failed to load all rows", ui.source.Err())
+	}
+
+	if ui.tables != nil && ui.tables.Done() && !ui.messagesSeen && len(ui.tables.Messages()) > 0 {
+		ui.showMessages()
+	}
+}
+
+// Rows that loaded since the last sync, read in the background to find
+// the ones matching the filter and their sort keys. Rows of an indexed
+// file are re-read from disk, which would hold up the event loop.
+//
+// Only rows loaded after any shell command ran are read, so the values
+// of the source are the ones displayed.
+type rowFeed struct {
+	first, end int
+	matches    []int
+	keys       []string // Only when sorted
+	values     []string // Only with a unique column, one for each match
+	done       atomic.Bool
+	stop       atomic.Bool // Filter or sort order changed in the meantime
+}
+
+func (f *rowFeed) read(source RowSource, filter Filter, sortColumn, uniqueColumn int) {
+	defer f.done.Store(true)
+
+	for i := f.first; i < f.end; i++ {
+		if f.stop.Load() {
+			return
+		}
+
+		row := source.Row(i)
+
+		if filter.Matches(row) {
+			f.matches = append(f.matches, i)
+
+			if uniqueColumn >= 0 {
+				f.values = append(f.values, row[uniqueColumn])
+			}
+		}
+
+		if sortColumn >= 0 {
+			f.keys = append(f.keys, row[sortColumn])
+		}
+	}
+}
+
+// Drop rows being read for an outdated filter or sort order, they'll be
+// read again by the next syncSource.
+func (ui *UI) stopFeed() {
+	if ui.feed != nil {
+		ui.feed.stop.Store(true)
+		ui.feed = nil
+	}
+}
+
+// Add the rows of a feed that has been read, leaving out values already
+// shown when only unique ones are.
+func (ui *UI) addRows(feed *rowFeed) {
+	ui.loaded = feed.end
+	matches, keys := feed.matches, feed.keys
+
+	if ui.uniqueColumn >= 0 {
+		matches = make([]int, 0, len(feed.matches))
+
+		for i, row := range feed.matches {
+			if _, seen := ui.uniqueSeen[feed.values[i]]; !seen {
+				ui.uniqueSeen[feed.values[i]] = struct{}{}
+				matches = append(matches, row)
+			}
+		}
+	}
+
+	if len(matches) > 0 {
+		ui.invalidateSearch()
+	}
+
+	if ui.sortColumn < 0 {
+		ui.filterMatches = append(ui.filterMatches, matches...)
+		return
+	}
+
+	ui.sortKeys = append(ui.sortKeys, keys...)
+
+	sorter := ui.sorter(matches)
+	sort.Stable(sorter)
+	ui.filterMatches = sorter.merge(ui.filterMatches)
+}
+
+// Whether any column has been changed with a shell command
+func (ui *UI) anyModified() bool {
+	for _, col := range ui.columns {
+		if col.Modified {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find the indices of rows to display in the background, and switch to
+// the new filter once done.
+func (ui *UI) filterRows(filter Filter) {
+	ui.runTask("Filtering", ui.loaded, func(t *Task) func() {
+		rows := make([]int, 0, 100)
+
+		for i := 0; i < ui.loaded; i++ {
+			if t.Cancelled() {
+				return nil
+			}
+
+			if filter.Matches(ui.getRow(i)) {
+				rows = append(rows, i)
+			}
+
+			t.Step()
+		}
+
+		return func() {
+			ui.stopFeed()
+			ui.filter = filter
+			ui.filterMatches = rows
+			ui.invalidateSearch()
+			ui.uniqueColumn = -1
+			ui.uniqueSeen = nil
+
+			// Filtering starts over from file order
+			ui.sortColumn = -1
+			ui.sortKeys = nil
+		}
+	})
+}
+
+// Sort the displayed rows by a column in the background. Rows that load
+// afterwards are merged in at the right spot.
+func (ui *UI) sortRows(colIdx int, reverse bool) {
+	ui.runTask("Sorting", ui.loaded, func(t *Task) func() {
+		keys := make([]string, ui.loaded)
+
+		for i := range keys {
+			if t.Cancelled() {
+				return nil
+			}
+
+			keys[i] = ui.getRow(i)[colIdx]
+			t.Step()
+		}
+
+		rows := make([]int, len(ui.filterMatches))
+		copy(rows, ui.filterMatches)
+
+		sort.Stable(rowSorter{rows, keys, reverse, t})
+		if t.Cancelled() {
+			return nil
+		}
+
+		return func() {
+			ui.stopFeed()
+			ui.filterMatches = rows
+			ui.invalidateSearch()
+			ui.sortColumn = colIdx
+			ui.sortReverse = reverse
+			ui.sortKeys = keys
+		}
+	})
+}
+
+func (ui *UI) sorter(rows []int) rowSorter {
+	return rowSorter{rows, ui.sortKeys, ui.sortReverse, nil}
+}
+
+type rowSorter struct {
+	rows    []int
+	keys    []string
+	reverse bool
+	task    *Task // Optional, stops comparing once cancelled
+}
+
+func (s rowSorter) Len() int      { return len(s.rows) }
+func (s rowSorter) Swap(i, j int) { s.rows[i], s.rows[j] = s.rows[j], s.rows[i] }
+func (s rowSorter) Less(i, j int) bool {
+	if s.task != nil && s.task.Cancelled() {
+		return false
+	}
+
+	return s.less(s.rows[i], s.rows[j])
+}
+
+func (s rowSorter) less(a, b int) bool {
+	if s.reverse {
+		return lessCells(s.keys[b], s.keys[a])
+	}
 
-	for i := 0; i < len(ui.rows); i++ {
-		if ui.filter.Matches(ui.getRow(i)) {
-			rows = append(rows, i)
+	return lessCells(s.keys[a], s.keys[b])
+}
+
+// Merge already sorted rows into s, keeping existing rows first on ties.
+func (s rowSorter) merge(existing []int) []int {
+	merged := make([]int, 0, len(existing)+len(s.rows))
+
+	i, j := 0, 0
+	for i < len(existing) && j < len(s.rows) {
+		if s.less(s.rows[j], existing[i]) {
+			merged = append(merged, s.rows[j])
+			j++
+		} else {
+			merged = append(merged, existing[i])
+			i++
 		}
 	}
 
-	ui.filterMatches = rows
+	merged = append(merged, existing[i:]...)
+	return append(merged, s.rows[j:]...)
+}
+
+// Compare numerically when both values are numbers
+func lessCells(a, b string) bool {
+	v1, err1 := strconv.ParseFloat(a, 32)
+	v2, err2 := strconv.ParseFloat(b, 32)
+
+	if err1 == nil && err2 == nil {
+		return v1 < v2
+	}
+
+	return a < b
 }
 
 func (ui *UI) repaint() {
@@ -281,7 +856,7 @@ func (ui *UI) pinnedWidth() (width int) {
 	for _, col := range ui.columns {
 		if col.Pinned {
 			width += col.displayWidth()
-			width += len(CellSeparator)
+			width += SeparatorWidth
 		}
 	}
 
@@ -304,24 +879,158 @@ func (ui *UI) columnOffset(colIdx int) (offset int, width int) {
 		if !col.Pinned {
 			width = col.displayWidth()
 			offset += width
-			offset += len(CellSeparator)
+			offset += SeparatorWidth
 		}
 	}
 
 	return offset, width
 }
 
+// Fit a column to its widest displayed value, in the background
 func (ui *UI) recomputeColumnWidth(colIdx int) {
-	width := len(ui.columns[colIdx].Name)
+	ui.runTask("Measuring column", len(ui.filterMatches), func(t *Task) func() {
+		width, ok := ui.measureColumn(colIdx, nil, t)
+		if !ok {
+			return nil
+		}
+
+		return func() { ui.columns[colIdx].Width = width }
+	})
+}
+
+// Width of the widest displayed value of a column, or of values instead
+// of the column's own where given. Meant to be run in a task, as rows of
+// an indexed file are read from disk again.
+func (ui *UI) measureColumn(colIdx int, values []string, t *Task) (int, bool) {
+	width := displayWidth(ui.columns[colIdx].Name)
 
 	for _, idx := range ui.filterMatches {
-		row := ui.getRow(idx)
-		if len(row[colIdx]) > width {
-			width = len(row[colIdx])
+		if t.Cancelled() {
+			return 0, false
+		}
+
+		var cell string
+		if idx < len(values) {
+			cell = values[idx]
+		} else {
+			cell = ui.getRow(idx)[colIdx]
+		}
+
+		if cellWidth := displayWidth(cellText(cell)); cellWidth > width {
+			width = cellWidth
+		}
+
+		t.Step()
+	}
+
+	return width, true
+}
+
+// Scroll just enough to make a cell visible, row being an index into
+// filterMatches.
+func (ui *UI) scrollToCell(row, colIdx int) {
+	ui.scrollToRow(row)
+	ui.scrollToColumn(colIdx)
+}
+
+func (ui *UI) scrollToRow(row int) {
+	_, vh := ui.viewSize()
+
+	if row < ui.offsetY {
+		ui.offsetY = row
+	} else if row >= ui.offsetY+vh {
+		ui.offsetY = row - vh + 1
+	}
+}
+
+func (ui *UI) scrollToColumn(colIdx int) {
+	vw, _ := ui.viewSize()
+
+	if colIdx < 0 || ui.columns[colIdx].Pinned {
+		return
+	}
+
+	offset, _ := ui.columnOffset(colIdx)
+	width := ui.columns[colIdx].displayWidth()
+
+	if offset < ui.offsetX {
+		ui.offsetX = offset
+	} else if offset+width > ui.offsetX+vw {
+		ui.offsetX = clamp(offset+width-vw, 0, offset)
+	}
+}
+
+// Furthest we can scroll down
+func (ui *UI) maxOffsetY() int {
+	_, vh := ui.viewSize()
+	return clamp(len(ui.filterMatches)-(vh-2), 0, len(ui.filterMatches)-1)
+}
+
+// Furthest we can scroll right
+func (ui *UI) maxOffsetX() int {
+	vw, _ := ui.viewSize()
+	lastColumnOffset, colWidth := ui.columnOffset(len(ui.columns) - 1)
+	endOfLine := (lastColumnOffset + colWidth) - vw
+
+	// prevent funky scrolling behavior when row is smaller than screen
+	if endOfLine < 0 {
+		endOfLine = 0
+	}
+
+	return endOfLine
+}
+
+// Modes that need to adjust themselves when the terminal is resized
+type resizeHandler interface {
+	Resize()
+}
+
+func (ui *UI) resize() {
+	ui.offsetX = clamp(ui.offsetX, 0, ui.maxOffsetX())
+	ui.offsetY = clamp(ui.offsetY, 0, ui.maxOffsetY())
+
+	for _, h := range ui.handlers {
+		if h, ok := h.(resizeHandler); ok {
+			h.Resize()
 		}
 	}
+}
 
-	ui.columns[colIdx].Width = width
+// Find the column drawn at screen position x, or -1 if there isn't one.
+// Pinned columns are drawn first, followed by the scrolled ones.
+func (ui *UI) columnAt(x int) int {
+	col, _ := ui.hitColumn(x)
+	return col
+}
+
+// Like columnAt, also reporting whether x is on the separator following
+// the column rather than its content.
+func (ui *UI) hitColumn(x int) (int, bool) {
+	pos := 0
+
+	for _, pinned := range []bool{true, false} {
+		if !pinned {
+			pos -= ui.offsetX
+		}
+
+		for i, col := range ui.columns {
+			if col.Pinned != pinned {
+				continue
+			}
+
+			pos += col.displayWidth()
+			if x < pos {
+				return i, false
+			}
+
+			pos += SeparatorWidth
+			if x < pos {
+				return i, true
+			}
+		}
+	}
+
+	return -1, false
 }
 
 // Find the first visually displayed column
@@ -396,14 +1105,15 @@ func (ui *UI) pushErrorPopup(msg string, err error) {
 func (ui *UI) getRow(idx int) []string {
 	row := make([]string, len(ui.columns))
 
-	if idx < 0 || idx >= len(ui.rows) {
-		panic(fmt.Errorf("Overflowed row bounds: %d [0, %d]", idx, len(ui.rows)))
+	if idx < 0 || idx >= ui.loaded {
+		panic(fmt.Errorf("Overflowed row bounds: %d [0, %d]", idx, ui.loaded))
 	}
 
-	origRow := ui.rows[idx]
+	origRow := ui.source.Row(idx)
 
 	for i, col := range ui.columns {
-		if col.Modified {
+		// Rows loaded after a shell command ran keep their original value
+		if col.Modified && idx < len(col.ModifiedValues) {
 			row[i] = col.ModifiedValues[idx]
 		} else {
 			row[i] = origRow[i]